@@ -0,0 +1,259 @@
+package exml
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CharsetReader is a function suitable for the xml.Decoder CharsetReader
+// field, it is installed by NewDecoder and can be used with decoders
+// passed to NewCustomDecoder. It converts ISO-8859-1, ISO-8859-15,
+// Windows-1252 and US-ASCII inputs to UTF-8. UTF-16 labels are accepted
+// as is since UTF-16 inputs must be converted before reaching the
+// xml.Decoder, see NewUTF8Reader.
+func CharsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch charsetName(label) {
+	case "iso-8859-1":
+		return &charmapReader{r: input, table: nil}, nil
+	case "iso-8859-15":
+		return &charmapReader{r: input, table: &iso885915}, nil
+	case "windows-1252":
+		return &charmapReader{r: input, table: &windows1252}, nil
+	case "us-ascii":
+		return &charmapReader{r: input, table: &usASCII}, nil
+	case "utf-16":
+		return input, nil
+	}
+
+	return nil, fmt.Errorf("exml: unsupported charset %q", label)
+}
+
+// charsetName returns the canonical name of a charset label, or the label
+// in lower case when it is unknown.
+func charsetName(label string) string {
+	name := strings.ToLower(strings.TrimSpace(label))
+	switch name {
+	case "utf-8", "utf8":
+		return "utf-8"
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "latin-1", "l1", "cp819", "ibm819":
+		return "iso-8859-1"
+	case "iso-8859-15", "iso8859-15", "iso_8859-15", "latin9", "latin-9", "l9":
+		return "iso-8859-15"
+	case "windows-1252", "cp1252", "x-cp1252":
+		return "windows-1252"
+	case "us-ascii", "ascii", "iso646-us", "ansi_x3.4-1968":
+		return "us-ascii"
+	case "utf-16", "utf-16le", "utf-16be", "utf16":
+		return "utf-16"
+	}
+	return name
+}
+
+// A conversion tracks the encoding of a multi-document input, which is
+// converted to UTF-8 from the first declaration of another encoding on.
+// The conversion applies to the rest of the input, so the next documents
+// must declare the same encoding, or none.
+type conversion struct {
+	encoding string
+}
+
+// reader is a CharsetReader function which converts the input on its first
+// call only.
+func (c *conversion) reader(label string, input io.Reader) (io.Reader, error) {
+	if c.encoding != "" {
+		return input, nil
+	}
+
+	r, err := CharsetReader(label, input)
+	if err == nil {
+		c.encoding = charsetName(label)
+	}
+	return r, err
+}
+
+// declare checks the encoding declared by a document once the input is
+// converted.
+func (c *conversion) declare(label string) error {
+	if label == "" || c.encoding == "" || charsetName(label) == c.encoding {
+		return nil
+	}
+	return fmt.Errorf("exml: document declares encoding %q after a document in %s", label, strings.ToUpper(c.encoding))
+}
+
+// NewUTF8Reader returns a reader detecting the encoding of an XML input
+// from its first bytes as described in appendix F of the XML
+// specification. UTF-16 inputs, with or without byte order mark, are
+// converted to UTF-8 and the UTF-8 byte order mark is removed. Other
+// inputs are passed through unchanged. The detection happens on the first
+// read. NewDecoder installs it automatically.
+func NewUTF8Reader(r io.Reader) io.Reader {
+	return &utf8Reader{r: r}
+}
+
+type utf8Reader struct {
+	r   io.Reader
+	src io.Reader
+}
+
+func (u *utf8Reader) Read(p []byte) (int, error) {
+	if u.src == nil {
+		u.src = detectEncoding(u.r)
+	}
+
+	return u.src.Read(p)
+}
+
+func detectEncoding(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(4)
+
+	switch {
+	case len(head) >= 2 && head[0] == 0xFF && head[1] == 0xFE:
+		br.Discard(2)
+		return &utf16Reader{r: br, bigEndian: false}
+	case len(head) >= 2 && head[0] == 0xFE && head[1] == 0xFF:
+		br.Discard(2)
+		return &utf16Reader{r: br, bigEndian: true}
+	case len(head) >= 3 && head[0] == 0xEF && head[1] == 0xBB && head[2] == 0xBF:
+		br.Discard(3)
+	case len(head) == 4 && head[0] == '<' && head[1] == 0 && head[2] == '?' && head[3] == 0:
+		return &utf16Reader{r: br, bigEndian: false}
+	case len(head) == 4 && head[0] == 0 && head[1] == '<' && head[2] == 0 && head[3] == '?':
+		return &utf16Reader{r: br, bigEndian: true}
+	}
+
+	return br
+}
+
+// A charmapReader converts a single byte encoding to UTF-8. A nil table
+// stands for ISO-8859-1 where every byte maps to the same code point.
+type charmapReader struct {
+	r     io.Reader
+	table *[256]rune
+	in    [1024]byte
+	out   []byte
+}
+
+func (c *charmapReader) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		n, err := c.r.Read(c.in[:])
+		for _, b := range c.in[:n] {
+			r := rune(b)
+			if c.table != nil {
+				r = c.table[b]
+			}
+			c.out = utf8.AppendRune(c.out, r)
+		}
+
+		if len(c.out) == 0 && err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.out)
+	c.out = c.out[:copy(c.out, c.out[n:])]
+	return n, nil
+}
+
+// A utf16Reader converts UTF-16 to UTF-8.
+type utf16Reader struct {
+	r         io.Reader
+	bigEndian bool
+	in        [1024]byte
+	pending   int
+	surrogate rune
+	out       []byte
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.out) == 0 {
+		n, err := u.r.Read(u.in[u.pending:])
+		n += u.pending
+
+		i := 0
+		for ; i+1 < n; i += 2 {
+			var r rune
+			if u.bigEndian {
+				r = rune(u.in[i])<<8 | rune(u.in[i+1])
+			} else {
+				r = rune(u.in[i+1])<<8 | rune(u.in[i])
+			}
+
+			// A high surrogate is held until the next unit, which must be
+			// a low surrogate. Otherwise it is replaced by U+FFFD and the
+			// next unit is decoded on its own.
+			if u.surrogate != 0 {
+				high := u.surrogate
+				u.surrogate = 0
+				if 0xDC00 <= r && r < 0xE000 {
+					u.out = utf8.AppendRune(u.out, utf16.DecodeRune(high, r))
+					continue
+				}
+				u.out = utf8.AppendRune(u.out, utf8.RuneError)
+			}
+			if 0xD800 <= r && r < 0xDC00 {
+				u.surrogate = r
+				continue
+			}
+
+			// Lone low surrogates are encoded as U+FFFD by AppendRune.
+			u.out = utf8.AppendRune(u.out, r)
+		}
+
+		u.pending = copy(u.in[:], u.in[i:n])
+		if len(u.out) == 0 && err != nil {
+			if err == io.EOF && (u.pending > 0 || u.surrogate != 0) {
+				u.pending, u.surrogate = 0, 0
+				u.out = utf8.AppendRune(u.out, utf8.RuneError)
+				break
+			}
+			return 0, err
+		}
+	}
+
+	n := copy(p, u.out)
+	u.out = u.out[:copy(u.out, u.out[n:])]
+	return n, nil
+}
+
+var windows1252 = charmap(map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„',
+	0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ',
+	0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ',
+	0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“',
+	0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›',
+	0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+})
+
+var iso885915 = charmap(map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž',
+	0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ',
+})
+
+var usASCII = func() [256]rune {
+	var t [256]rune
+	for i := range t {
+		t[i] = rune(i)
+		if i >= 0x80 {
+			t[i] = utf8.RuneError
+		}
+	}
+	return t
+}()
+
+// charmap returns an ISO-8859-1 based table with the passed differences.
+func charmap(diffs map[byte]rune) [256]rune {
+	var t [256]rune
+	for i := range t {
+		t[i] = rune(i)
+	}
+	for b, r := range diffs {
+		t[b] = r
+	}
+	return t
+}
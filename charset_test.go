@@ -0,0 +1,116 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing/iotest"
+	"unicode/utf16"
+
+	"gopkg.in/check.v1"
+)
+
+const CHARSET = `<?xml version="1.0" encoding="%s"?>
+<root><node>%s</node></root>`
+
+func runCharsetTest(c *check.C, data []byte, expected string) {
+	texts := []string{}
+	decoder := NewDecoder(bytes.NewReader(data))
+	decoder.OnTextOf("root/node", Append(&texts))
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(texts, check.DeepEquals, []string{expected})
+}
+
+func singleByteDoc(encoding string, text []byte) []byte {
+	doc := strings.Replace(CHARSET, "%s", encoding, 1)
+	return []byte(strings.Replace(doc, "%s", string(text), 1))
+}
+
+func utf16Doc(text string, bigEndian bool, bom bool) []byte {
+	doc := strings.Replace(CHARSET, "%s", "UTF-16", 1)
+	doc = strings.Replace(doc, "%s", text, 1)
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+
+	units := utf16.Encode([]rune(doc))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(b[2*i:], u)
+	}
+
+	return b
+}
+
+func (s *EXMLSuite) Test_CharsetLatin1(c *check.C) {
+	runCharsetTest(c, singleByteDoc("ISO-8859-1", []byte("caf\xe9 \xa4")), "café ¤")
+}
+
+func (s *EXMLSuite) Test_CharsetLatin9(c *check.C) {
+	runCharsetTest(c, singleByteDoc("ISO-8859-15", []byte("caf\xe9 \xa4")), "café €")
+}
+
+func (s *EXMLSuite) Test_CharsetWindows1252(c *check.C) {
+	runCharsetTest(c, singleByteDoc("windows-1252", []byte("\x93caf\xe9\x94 \x80")), "“café” €")
+}
+
+func (s *EXMLSuite) Test_CharsetASCII(c *check.C) {
+	runCharsetTest(c, singleByteDoc("US-ASCII", []byte("cafe\xe9")), "cafe�")
+}
+
+func (s *EXMLSuite) Test_CharsetUTF16(c *check.C) {
+	text := "café 𝄞 €"
+	runCharsetTest(c, utf16Doc(text, false, true), text)
+	runCharsetTest(c, utf16Doc(text, true, true), text)
+	runCharsetTest(c, utf16Doc(text, false, false), text)
+	runCharsetTest(c, utf16Doc(text, true, false), text)
+
+	texts := []string{}
+	decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(utf16Doc(text, false, true))))
+	decoder.OnTextOf("root/node", Append(&texts))
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(texts, check.DeepEquals, []string{text})
+}
+
+func (s *EXMLSuite) Test_CharsetUTF16Surrogates(c *check.C) {
+	units := []uint16{0xFEFF}
+	units = append(units, utf16.Encode([]rune("<root><node>a"))...)
+	units = append(units, 0xDC00)
+	units = append(units, utf16.Encode([]rune("b"))...)
+	units = append(units, 0xD800)
+	units = append(units, utf16.Encode([]rune("</node><node>"))...)
+	units = append(units, 0xD834)
+	units = append(units, utf16.Encode([]rune("c</node></root>"))...)
+
+	doc := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(doc[2*i:], u)
+	}
+
+	texts := []string{}
+	decoder := NewDecoder(bytes.NewReader(doc))
+	decoder.OnTextOf("root/node", Append(&texts))
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(texts, check.DeepEquals, []string{"a\uFFFDb\uFFFD", "\uFFFDc"})
+}
+
+func (s *EXMLSuite) Test_CharsetUTF8BOM(c *check.C) {
+	texts := []string{}
+	decoder := NewDecoder(strings.NewReader("\xef\xbb\xbf" + NESTED_TEXT))
+	decoder.OnText(Append(&texts))
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(texts, check.DeepEquals, []string{"Root text 1", "Node text", "Root text 2"})
+}
+
+func (s *EXMLSuite) Test_CharsetUnsupported(c *check.C) {
+	decoder := NewDecoder(bytes.NewReader(singleByteDoc("EBCDIC", []byte("text"))))
+	c.Assert(decoder.Run(), check.ErrorMatches, `.*unsupported charset "EBCDIC".*`)
+}
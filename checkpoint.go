@@ -0,0 +1,159 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// A Checkpoint is the state of a decoder at a token boundary, from which
+// parsing can be resumed with ResumeDecoder. It only holds exported plain
+// values and can be serialized with encoding/json or encoding/gob.
+type Checkpoint struct {
+	// Offset is the offset of the token boundary in the input, not
+	// counting the UTF-8 byte order mark. Offsets in documents declaring
+	// another encoding are offsets in the input converted to UTF-8, and
+	// are rejected by ResumeDecoder.
+	Offset int64
+
+	// Line and Column are the position of the token boundary.
+	Line   int
+	Column int
+
+	// Stack holds the elements open at the token boundary, the outermost
+	// being the first, with all their attributes including the namespace
+	// declarations.
+	Stack []xml.StartElement
+}
+
+// Checkpoint returns the state of the decoder before the token being
+// dispatched. Called from the tag callback of a record, it returns the
+// state right before the start tag of the record, so that resuming from it
+// dispatches the record again.
+func (d *Decoder) Checkpoint() Checkpoint {
+	open := d.stack
+	if d.opened {
+		open = open[:len(open)-1]
+	}
+
+	cp := Checkpoint{
+		Offset: d.offset,
+		Line:   d.line,
+		Column: d.column,
+		Stack:  make([]xml.StartElement, len(open)),
+	}
+
+	for i, f := range open {
+		cp.Stack[i] = xml.StartElement{Name: f.name, Attr: slices.Clone(f.attr)}
+	}
+
+	return cp
+}
+
+// ResumeDecoder creates a new exml parser continuing the parsing of the
+// UTF-8 document read from r at the passed checkpoint. Documents in other
+// encodings, UTF-16 or declared ones, are rejected. Handlers are then
+// registered as usual, and Run starts by calling the tag callbacks of the
+// open elements of the checkpoint, outermost first, so that handlers
+// registered from callbacks are installed and every callback sees the same
+// path as in the original pass. The text which preceded the checkpoint in
+// these elements is not dispatched again.
+func ResumeDecoder(r io.ReadSeeker, cp Checkpoint) (*Decoder, error) {
+	var head [headSize]byte
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	n, err := io.ReadFull(r, head[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+
+	bom, err := offsetBase(head[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Seek(bom+cp.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return resumeDecoder(r, cp)
+}
+
+// headSize is the size of the head of a document passed to offsetBase,
+// enough for an XML declaration.
+const headSize = 256
+
+// offsetBase returns the size of the UTF-8 byte order mark starting the
+// passed head of a document, which offsets do not account for since
+// NewDecoder removes it. UTF-16 documents and documents declaring another
+// encoding than UTF-8 are rejected since their offsets are offsets in the
+// document converted to UTF-8.
+func offsetBase(head []byte) (int64, error) {
+	var bom int64
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		bom = 3
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}), bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return 0, errors.New("exml: offsets in UTF-16 documents are not supported")
+	}
+
+	decl, ok := bytes.CutPrefix(head[bom:], []byte("<?xml"))
+	if end := bytes.Index(decl, []byte("?>")); ok && end >= 0 {
+		enc := declValue(string(decl[:end]), "encoding")
+		if enc != "" && !strings.EqualFold(enc, "utf-8") && !strings.EqualFold(enc, "utf8") {
+			return 0, fmt.Errorf("exml: offsets in %s documents are not supported", enc)
+		}
+	}
+
+	return bom, nil
+}
+
+// resumeDecoder returns a decoder reading r from the offset of the passed
+// checkpoint.
+func resumeDecoder(r io.Reader, cp Checkpoint) (*Decoder, error) {
+	input := &inputReader{r: r}
+	stream := newStreamReader(input)
+	xd := xml.NewDecoder(stream)
+	xd.CharsetReader = CharsetReader
+	d := NewCustomDecoder(xd)
+	d.input = input
+	d.stream = stream
+
+	if err := d.prime(stream, frames(cp.Stack), cp.Offset, cp.Line, cp.Column); err != nil {
+		return nil, err
+	}
+
+	d.resume = cp.Stack
+	return d, nil
+}
+
+// frames returns inert frames for the passed open elements.
+func frames(open []xml.StartElement) []frame {
+	f := make([]frame, len(open))
+	for i, t := range open {
+		f[i] = frame{name: t.Name, attr: t.Attr}
+	}
+	return f
+}
+
+// replay dispatches the open elements of the checkpoint a decoder was
+// resumed from.
+func (d *Decoder) replay() error {
+	open := d.resume
+	d.resume = nil
+
+	d.line, d.column, d.offset = d.position()
+	for _, t := range open {
+		t.Attr = slices.Clone(t.Attr)
+		if err := d.startElement(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package exml
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const DUMP = "\ufeff" + `<?xml version="1.0"?>
+<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.10/" xmlns:x="urn:x" lang="en">
+    <siteinfo><sitename>Wiki</sitename></siteinfo>
+    <page><title>First</title><revision x:id="1"><text>One</text></revision></page>
+    <page><title>Second</title><revision x:id="2"><text>Two</text></revision></page>
+    <page><title>Third</title><revision x:id="3"><text>Three &amp; more</text></revision></page>
+</mediawiki>`
+
+type dumpRecorder struct {
+	langs  []string
+	titles []string
+	texts  []string
+	paths  []string
+}
+
+func (r *dumpRecorder) setup(d *Decoder, pages *[]Checkpoint) {
+	d.On("mediawiki", func(attrs Attrs) {
+		r.langs = append(r.langs, attrs.GetString("lang", ""))
+		d.On("page", func(attrs Attrs) {
+			*pages = append(*pages, d.Checkpoint())
+			d.OnTextOf("title", Append(&r.titles))
+			d.On("revision", func(attrs Attrs) {
+				r.paths = append(r.paths, d.path())
+				d.OnTextOf("text", Append(&r.texts))
+			})
+		})
+	})
+}
+
+func (s *EXMLSuite) Test_Checkpoint(c *check.C) {
+	full := &dumpRecorder{}
+	pages := []Checkpoint{}
+	decoder := NewDecoder(strings.NewReader(DUMP))
+	full.setup(decoder, &pages)
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(full.titles, check.DeepEquals, []string{"First", "Second", "Third"})
+	c.Assert(pages, check.HasLen, 3)
+
+	cp := pages[1]
+	c.Assert(cp.Line, check.Equals, 5)
+	c.Assert(cp.Column, check.Equals, 5)
+	c.Assert(cp.Stack, check.HasLen, 1)
+	c.Assert(cp.Stack[0].Name.Local, check.Equals, "mediawiki")
+
+	data, err := json.Marshal(cp)
+	c.Assert(err, check.IsNil)
+	restored := Checkpoint{}
+	c.Assert(json.Unmarshal(data, &restored), check.IsNil)
+
+	resumed := &dumpRecorder{}
+	resumedPages := []Checkpoint{}
+	decoder, err = ResumeDecoder(strings.NewReader(DUMP), restored)
+	c.Assert(err, check.IsNil)
+	resumed.setup(decoder, &resumedPages)
+	c.Assert(decoder.Run(), check.IsNil)
+
+	c.Assert(resumed.langs, check.DeepEquals, []string{"en"})
+	c.Assert(resumed.titles, check.DeepEquals, full.titles[1:])
+	c.Assert(resumed.texts, check.DeepEquals, full.texts[1:])
+	c.Assert(resumed.paths, check.DeepEquals, full.paths[1:])
+	c.Assert(resumedPages, check.DeepEquals, pages[1:])
+}
+
+func (s *EXMLSuite) Test_CheckpointNested(c *check.C) {
+	var cp Checkpoint
+	decoder := NewDecoder(strings.NewReader(DUMP))
+	decoder.OnTextOf("mediawiki/page/revision/text", func(text CharData) {
+		if string(text) == "Two" {
+			cp = decoder.Checkpoint()
+		}
+	})
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(cp.Stack, check.HasLen, 4)
+
+	texts := []string{}
+	ids := []string{}
+	decoder, err := ResumeDecoder(strings.NewReader(DUMP), cp)
+	c.Assert(err, check.IsNil)
+	decoder.On("revision", func(attrs Attrs) {
+		ids = append(ids, attrs.GetString("id", ""))
+	})
+	decoder.OnTextOf("text", Append(&texts))
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(ids, check.DeepEquals, []string{"2", "3"})
+	c.Assert(texts, check.DeepEquals, []string{"Three & more"})
+}
+
+func (s *EXMLSuite) Test_CheckpointLatin1(c *check.C) {
+	doc := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<root><p>caf\xe9</p><p>two</p></root>"
+
+	var cp Checkpoint
+	decoder := NewDecoder(strings.NewReader(doc))
+	decoder.OnTextOf("root/p", func(text CharData) {
+		if string(text) == "café" {
+			cp = decoder.Checkpoint()
+		}
+	})
+	c.Assert(decoder.Run(), check.IsNil)
+
+	_, err := ResumeDecoder(strings.NewReader(doc), cp)
+	c.Assert(err, check.ErrorMatches, "exml: offsets in ISO-8859-1 documents are not supported")
+
+	_, err = ResumeDecoder(strings.NewReader("\xef\xbb\xbf<?xml version='1.0' encoding='UTF-8'?><root/>"), Checkpoint{})
+	c.Assert(err, check.IsNil)
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const genUsage = `usage: exml gen [-package NAME] [-root ELEMENT] [-o FILE] [FILE...]
+
+Generates Go structs for the documents described by an XSD schema, or by
+sample documents, along with functions registering the exml handlers which
+populate them. Files ending with .xsd are read as schemas, their imports and
+includes being loaded as well, and other files as samples, the types of
+values being inferred from the samples.
+
+flags:
+`
+
+// gen runs the gen command.
+func gen(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, genUsage)
+		flags.PrintDefaults()
+	}
+	pkg := flags.String("package", "main", "name of the package of the generated code")
+	root := flags.String("root", "", "generate the decoding function of this root element only")
+	output := flags.String("o", "", "write the generated code to this file instead of the standard output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if !token.IsIdentifier(*pkg) {
+		flags.Usage()
+		return 2
+	}
+
+	report := func(name string, err error) {
+		fmt.Fprintln(stderr, diagnostic(name, err))
+	}
+
+	var (
+		model *goModel
+		err   error
+	)
+	if flags.NArg() > 0 && strings.HasSuffix(flags.Arg(0), ".xsd") {
+		model, err = modelFromSchema(flags.Args(), stdin, *root, report)
+	} else {
+		model, err = modelFromSamples(flags.Args(), stdin, *root, report)
+	}
+	if err == nil && len(model.roots) == 0 {
+		err = errors.New("no root element with attributes or children")
+	}
+	if err == errReported {
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "exml: %v\n", err)
+		return 1
+	}
+
+	code, err := model.generate(*pkg)
+	if err != nil {
+		fmt.Fprintf(stderr, "exml: %v\n", err)
+		return 1
+	}
+
+	if *output != "" {
+		err = os.WriteFile(*output, code, 0o644)
+	} else {
+		out := bufio.NewWriter(stdout)
+		out.Write(code)
+		err = out.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "exml: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// errReported is returned when the failures were already reported.
+var errReported = errors.New("errors reported")
+
+// A goModel holds the structs generated for a family of documents.
+type goModel struct {
+	roots   []goRoot
+	structs []*goStruct
+	names   map[string]bool
+}
+
+// A goRoot is a root element along with the struct populated from it.
+type goRoot struct {
+	element string
+	s       *goStruct
+}
+
+// A goStruct is a struct populated from elements, described by from.
+type goStruct struct {
+	name   string
+	from   string
+	fields []*goField
+}
+
+// A goField is a field populated from an attribute, from a child element
+// or from the text of the element.
+type goField struct {
+	name     string
+	kind     fieldKind
+	xml      string
+	scalar   string
+	s        *goStruct
+	repeated bool
+}
+
+type fieldKind int
+
+const (
+	attrField fieldKind = iota
+	childField
+	textField
+)
+
+func newModel() *goModel {
+	return &goModel{names: map[string]bool{}}
+}
+
+// newStruct adds a struct named after the passed XML name.
+func (m *goModel) newStruct(name string, from string) *goStruct {
+	s := &goStruct{name: unique(m.names, goName(name)), from: from}
+	m.structs = append(m.structs, s)
+	return s
+}
+
+// field returns the field of a struct populated from an attribute, a child
+// element or the text, added when missing.
+func (s *goStruct) field(kind fieldKind, xml string) (*goField, bool) {
+	for _, f := range s.fields {
+		if f.kind == kind && f.xml == xml {
+			return f, false
+		}
+	}
+
+	f := &goField{kind: kind, xml: xml}
+	s.fields = append(s.fields, f)
+	return f, true
+}
+
+// addScalar adds or widens a scalar field.
+func (s *goStruct) addScalar(kind fieldKind, xml string, scalar string, repeated bool) {
+	f, added := s.field(kind, xml)
+	if added || f.s != nil {
+		f.scalar, f.s = scalar, nil
+	} else {
+		f.scalar = widen(f.scalar, scalar)
+	}
+	f.repeated = f.repeated || repeated
+}
+
+// addStruct adds a child field holding a struct.
+func (s *goStruct) addStruct(xml string, child *goStruct, repeated bool) {
+	f, _ := s.field(childField, xml)
+	f.s, f.scalar = child, ""
+	f.repeated = f.repeated || repeated
+}
+
+// widen returns the scalar type which can hold the values of both passed
+// types.
+func widen(a, b string) string {
+	switch {
+	case a == b:
+		return a
+	case (a == "int64" && b == "float64") || (a == "float64" && b == "int64"):
+		return "float64"
+	}
+	return "string"
+}
+
+// typeName returns the Go type of a field.
+func (f *goField) typeName() string {
+	t := f.scalar
+	if f.s != nil {
+		t = "*" + f.s.name
+	}
+	if f.repeated {
+		t = "[]" + t
+	}
+	return t
+}
+
+// nameFields names the fields of a struct after their XML names, the
+// repeated ones in the plural.
+func (s *goStruct) nameFields() {
+	names := map[string]bool{}
+	for _, f := range s.fields {
+		name := "Text"
+		if f.kind != textField {
+			name = goName(f.xml)
+		}
+		if f.repeated {
+			name = plural(name)
+		}
+		f.name = unique(names, name)
+	}
+}
+
+// generate returns the formatted source of the model.
+func (m *goModel) generate(pkg string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by exml gen; DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	fmt.Fprintf(&b, "import \"gopkg.in/lucsky/go-exml.v3\"\n")
+
+	for _, s := range m.structs {
+		s.nameFields()
+	}
+
+	for _, s := range m.structs {
+		writeComment(&b, fmt.Sprintf("%s is populated from %s.", s.name, s.from))
+		fmt.Fprintf(&b, "type %s struct {\n", s.name)
+		for _, f := range s.fields {
+			fmt.Fprintf(&b, "%s %s\n", f.name, f.typeName())
+		}
+		fmt.Fprintf(&b, "}\n")
+	}
+
+	for _, r := range m.roots {
+		writeComment(&b, fmt.Sprintf("Decode%s registers the handlers populating v from the %s root element of the document parsed by d.", r.s.name, r.element))
+		fmt.Fprintf(&b, "func Decode%s(d *exml.Decoder, v *%s) {\n", r.s.name, r.s.name)
+		fmt.Fprintf(&b, "d.On(%q, func(attrs exml.Attrs) {\ndecode%s(d, v, attrs)\n})\n}\n", r.element, r.s.name)
+	}
+
+	for _, s := range m.structs {
+		s.generateDecode(&b)
+	}
+
+	return format.Source(b.Bytes())
+}
+
+// generateDecode writes the function registering the handlers which
+// populate a struct from the content of an element.
+func (s *goStruct) generateDecode(b *bytes.Buffer) {
+	writeComment(b, fmt.Sprintf("decode%s populates v from the attributes and the content of %s.", s.name, s.from))
+	fmt.Fprintf(b, "func decode%s(d *exml.Decoder, v *%s, attrs exml.Attrs) {\n", s.name, s.name)
+
+	for _, f := range s.fields {
+		switch {
+		case f.kind == attrField:
+			fmt.Fprintf(b, "v.%s = %s\n", f.name, attrGetter(f.scalar, f.xml))
+		case f.kind == textField:
+			fmt.Fprintf(b, "d.OnText(%s)\n", textSetter(f))
+		case f.s == nil:
+			fmt.Fprintf(b, "d.OnTextOf(%q, %s)\n", f.xml, textSetter(f))
+		case f.repeated:
+			fmt.Fprintf(b, "d.On(%q, func(attrs exml.Attrs) {\n", f.xml)
+			fmt.Fprintf(b, "item := &%s{}\nv.%s = append(v.%s, item)\ndecode%s(d, item, attrs)\n})\n", f.s.name, f.name, f.name, f.s.name)
+		default:
+			fmt.Fprintf(b, "d.On(%q, func(attrs exml.Attrs) {\n", f.xml)
+			fmt.Fprintf(b, "v.%s = &%s{}\ndecode%s(d, v.%s, attrs)\n})\n", f.name, f.s.name, f.s.name, f.name)
+		}
+	}
+
+	fmt.Fprintf(b, "}\n")
+}
+
+// writeComment writes a doc comment preceded by an empty line, wrapping the
+// text at 80 columns.
+func writeComment(b *bytes.Buffer, text string) {
+	b.WriteString("\n//")
+	width := 2
+	for _, word := range strings.Fields(text) {
+		if width > 2 && width+1+len(word) > 80 {
+			b.WriteString("\n//")
+			width = 2
+		}
+		b.WriteByte(' ')
+		b.WriteString(word)
+		width += 1 + len(word)
+	}
+	b.WriteByte('\n')
+}
+
+// attrGetter returns the expression reading an attribute of a scalar type.
+func attrGetter(scalar string, name string) string {
+	switch scalar {
+	case "int64":
+		return fmt.Sprintf("attrs.GetInt(%q, 10, 64, 0)", name)
+	case "float64":
+		return fmt.Sprintf("attrs.GetFloat(%q, 64, 0)", name)
+	case "bool":
+		return fmt.Sprintf("attrs.GetBool(%q, false)", name)
+	}
+	return fmt.Sprintf("attrs.GetString(%q, \"\")", name)
+}
+
+// textSetter returns the text callback populating a scalar field.
+func textSetter(f *goField) string {
+	helper := "Assign"
+	if f.repeated {
+		helper = "Append"
+	}
+
+	switch f.scalar {
+	case "int64":
+		return fmt.Sprintf("exml.%sInt(&v.%s, 10, 64, 0)", helper, f.name)
+	case "float64":
+		return fmt.Sprintf("exml.%sFloat(&v.%s, 64, 0)", helper, f.name)
+	case "bool":
+		return fmt.Sprintf("exml.%sBool(&v.%s, false)", helper, f.name)
+	}
+	return fmt.Sprintf("exml.%s(&v.%s)", helper, f.name)
+}
+
+// initialisms are written in upper case in Go names.
+var initialisms = map[string]bool{
+	"id": true, "url": true, "uri": true, "xml": true, "html": true, "http": true,
+	"json": true, "api": true, "uuid": true, "sku": true,
+}
+
+// goName returns the exported Go name of an XML name, splitting words at
+// punctuation and at case changes.
+func goName(name string) string {
+	var words []string
+	word := []rune{}
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+
+	var b strings.Builder
+	for _, w := range words {
+		if initialisms[strings.ToLower(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		b.WriteRune(unicode.ToUpper(r[0]))
+		b.WriteString(string(r[1:]))
+	}
+
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+// plural returns the plural of an English word.
+func plural(word string) string {
+	switch {
+	case strings.HasSuffix(word, "s") || strings.HasSuffix(word, "x") || strings.HasSuffix(word, "z") ||
+		strings.HasSuffix(word, "ch") || strings.HasSuffix(word, "sh"):
+		return word + "es"
+	case strings.HasSuffix(word, "y") && len(word) > 1 && !strings.ContainsRune("aeiouAEIOU", rune(word[len(word)-2])):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
+
+// unique returns name, or name followed by the smallest number making it
+// unique, and records it.
+func unique(names map[string]bool, name string) string {
+	candidate := name
+	for i := 2; names[candidate]; i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+
+	names[candidate] = true
+	return candidate
+}
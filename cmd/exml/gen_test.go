@@ -0,0 +1,346 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const SAMPLE = `<address-book name="homies">
+    <contact id="1" vip="true">
+        <first-name>Tim</first-name>
+        <phone>555-1234</phone>
+        <phone>555-5678</phone>
+        <score>12</score>
+    </contact>
+    <contact id="2">
+        <first-name>Steve</first-name>
+        <score>7.5</score>
+        <note lang="en">Redmond</note>
+    </contact>
+</address-book>`
+
+const ORDER_SCHEMA = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:c="urn:common"
+           xmlns="urn:order" targetNamespace="urn:order">
+    <xs:import namespace="urn:common" schemaLocation="common/common.xsd"/>
+    <xs:element name="order" type="OrderType"/>
+    <xs:element name="comment" type="xs:string"/>
+    <xs:complexType name="OrderType">
+        <xs:sequence>
+            <xs:element ref="c:ID"/>
+            <xs:element name="customer" type="c:PartyType"/>
+            <xs:element name="line" maxOccurs="unbounded">
+                <xs:complexType>
+                    <xs:sequence>
+                        <xs:element name="quantity" type="xs:positiveInteger"/>
+                        <xs:element name="price" type="c:AmountType"/>
+                    </xs:sequence>
+                    <xs:attribute name="number" type="xs:int"/>
+                </xs:complexType>
+            </xs:element>
+            <xs:group ref="NotesGroup"/>
+        </xs:sequence>
+        <xs:attribute name="paid" type="xs:boolean"/>
+    </xs:complexType>
+    <xs:group name="NotesGroup">
+        <xs:choice>
+            <xs:element name="note" type="xs:string" maxOccurs="unbounded"/>
+        </xs:choice>
+    </xs:group>
+</xs:schema>`
+
+const COMMON_SCHEMA = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns="urn:common"
+           targetNamespace="urn:common">
+    <xs:element name="ID" type="IdentifierType"/>
+    <xs:complexType name="IdentifierType">
+        <xs:simpleContent>
+            <xs:extension base="xs:string">
+                <xs:attribute name="schemeID" type="xs:string"/>
+            </xs:extension>
+        </xs:simpleContent>
+    </xs:complexType>
+    <xs:complexType name="AmountType">
+        <xs:simpleContent>
+            <xs:extension base="Decimal">
+                <xs:attributeGroup ref="CurrencyGroup"/>
+            </xs:extension>
+        </xs:simpleContent>
+    </xs:complexType>
+    <xs:simpleType name="Decimal">
+        <xs:restriction base="xs:decimal"/>
+    </xs:simpleType>
+    <xs:attributeGroup name="CurrencyGroup">
+        <xs:attribute name="currency" type="xs:string"/>
+    </xs:attributeGroup>
+    <xs:complexType name="BasePartyType">
+        <xs:sequence>
+            <xs:element name="name" type="xs:string"/>
+        </xs:sequence>
+    </xs:complexType>
+    <xs:complexType name="PartyType">
+        <xs:complexContent>
+            <xs:extension base="BasePartyType">
+                <xs:sequence>
+                    <xs:element name="contact" type="PartyType" minOccurs="0"/>
+                </xs:sequence>
+            </xs:extension>
+        </xs:complexContent>
+    </xs:complexType>
+</xs:schema>`
+
+func (s *CmdSuite) Test_GenSamples(c *check.C) {
+	status, stdout, stderr := command(SAMPLE, "gen", "-package", "contacts")
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stderr, check.Equals, "")
+	c.Assert(stdout, check.Equals, `// Code generated by exml gen; DO NOT EDIT.
+
+package contacts
+
+import "gopkg.in/lucsky/go-exml.v3"
+
+// AddressBook is populated from address-book elements.
+type AddressBook struct {
+	Name     string
+	Contacts []*Contact
+}
+
+// Contact is populated from contact elements.
+type Contact struct {
+	ID        int64
+	Vip       bool
+	FirstName string
+	Phones    []string
+	Score     float64
+	Note      *Note
+}
+
+// Note is populated from note elements.
+type Note struct {
+	Lang string
+	Text string
+}
+
+// DecodeAddressBook registers the handlers populating v from the address-book
+// root element of the document parsed by d.
+func DecodeAddressBook(d *exml.Decoder, v *AddressBook) {
+	d.On("address-book", func(attrs exml.Attrs) {
+		decodeAddressBook(d, v, attrs)
+	})
+}
+
+// decodeAddressBook populates v from the attributes and the content of
+// address-book elements.
+func decodeAddressBook(d *exml.Decoder, v *AddressBook, attrs exml.Attrs) {
+	v.Name = attrs.GetString("name", "")
+	d.On("contact", func(attrs exml.Attrs) {
+		item := &Contact{}
+		v.Contacts = append(v.Contacts, item)
+		decodeContact(d, item, attrs)
+	})
+}
+
+// decodeContact populates v from the attributes and the content of contact
+// elements.
+func decodeContact(d *exml.Decoder, v *Contact, attrs exml.Attrs) {
+	v.ID = attrs.GetInt("id", 10, 64, 0)
+	v.Vip = attrs.GetBool("vip", false)
+	d.OnTextOf("first-name", exml.Assign(&v.FirstName))
+	d.OnTextOf("phone", exml.Append(&v.Phones))
+	d.OnTextOf("score", exml.AssignFloat(&v.Score, 64, 0))
+	d.On("note", func(attrs exml.Attrs) {
+		v.Note = &Note{}
+		decodeNote(d, v.Note, attrs)
+	})
+}
+
+// decodeNote populates v from the attributes and the content of note elements.
+func decodeNote(d *exml.Decoder, v *Note, attrs exml.Attrs) {
+	v.Lang = attrs.GetString("lang", "")
+	d.OnText(exml.Assign(&v.Text))
+}
+`)
+}
+
+const SAMPLE_MAIN = `package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/lucsky/go-exml.v3"
+)
+
+func main() {
+	book := &AddressBook{}
+	d := exml.NewDecoder(os.Stdin)
+	DecodeAddressBook(d, book)
+	if err := d.Run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Println(book.Name)
+	for _, contact := range book.Contacts {
+		fmt.Println(contact.ID, contact.Vip, contact.FirstName, contact.Phones, contact.Score, contact.Note)
+	}
+}
+`
+
+func (s *CmdSuite) Test_GenSamplesRun(c *check.C) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		c.Skip("go tool not found")
+	}
+
+	// The generated code is built against a copy of the package.
+	dir := c.MkDir()
+	lib := filepath.Join(dir, "exml")
+	c.Assert(os.Mkdir(lib, 0o755), check.IsNil)
+	sources, err := filepath.Glob(filepath.Join("..", "..", "*.go"))
+	c.Assert(err, check.IsNil)
+	for _, source := range sources {
+		if strings.HasSuffix(source, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(source)
+		c.Assert(err, check.IsNil)
+		writeFile(c, lib, filepath.Base(source), data)
+	}
+	writeFile(c, lib, "go.mod", []byte("module gopkg.in/lucsky/go-exml.v3\n\ngo 1.23\n"))
+
+	app := filepath.Join(dir, "app")
+	c.Assert(os.Mkdir(app, 0o755), check.IsNil)
+	writeFile(c, app, "go.mod", []byte("module app\n\ngo 1.23\n\n"+
+		"require gopkg.in/lucsky/go-exml.v3 v3.0.0\n\n"+
+		"replace gopkg.in/lucsky/go-exml.v3 => ../exml\n"))
+	writeFile(c, app, "main.go", []byte(SAMPLE_MAIN))
+	status, stdout, stderr := command(SAMPLE, "gen", "-o", filepath.Join(app, "contacts.go"))
+	c.Assert(status, check.Equals, 0, check.Commentf(stdout+stderr))
+
+	cmd := exec.Command(goTool, "run", ".")
+	cmd.Dir = app
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod", "GOPROXY=off")
+	cmd.Stdin = strings.NewReader(SAMPLE)
+	out, err := cmd.CombinedOutput()
+	c.Assert(err, check.IsNil, check.Commentf("%s", out))
+	c.Assert(string(out), check.Equals, "homies\n"+
+		"1 true Tim [555-1234 555-5678] 12 <nil>\n"+
+		"2 false Steve [] 7.5 &{en Redmond}\n")
+}
+
+func (s *CmdSuite) Test_GenSchema(c *check.C) {
+	dir := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(dir, "common"), 0o755), check.IsNil)
+	writeFile(c, dir, "common/common.xsd", []byte(COMMON_SCHEMA))
+	order := writeFile(c, dir, "order.xsd", []byte(ORDER_SCHEMA))
+
+	status, stdout, stderr := command("", "gen", order)
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stderr, check.Equals, "")
+
+	structs, functions, _ := strings.Cut(stdout, "\n// DecodeOrder ")
+	c.Assert(structs, check.Equals, `// Code generated by exml gen; DO NOT EDIT.
+
+package main
+
+import "gopkg.in/lucsky/go-exml.v3"
+
+// Order is populated from elements of the OrderType type.
+type Order struct {
+	Paid     bool
+	ID       *Identifier
+	Customer *Party
+	Lines    []*Line
+	Notes    []string
+}
+
+// Identifier is populated from elements of the IdentifierType type.
+type Identifier struct {
+	SchemeID string
+	Text     string
+}
+
+// Party is populated from elements of the PartyType type.
+type Party struct {
+	Name    string
+	Contact *Party
+}
+
+// Line is populated from line elements.
+type Line struct {
+	Number   int64
+	Quantity int64
+	Price    *Amount
+}
+
+// Amount is populated from elements of the AmountType type.
+type Amount struct {
+	Currency string
+	Text     float64
+}
+`)
+	c.Assert(functions, check.Matches, `(?s)registers the handlers populating v from the order root.*`+
+		`d\.On\("ID", func\(attrs exml\.Attrs\) \{\n\t\tv\.ID = &Identifier\{\}\n\t\tdecodeIdentifier\(d, v\.ID, attrs\).*`+
+		`d\.OnTextOf\("note", exml\.Append\(&v\.Notes\)\).*`+
+		`d\.On\("contact", func\(attrs exml\.Attrs\) \{\n\t\tv\.Contact = &Party\{\}\n\t\tdecodeParty\(d, v\.Contact, attrs\).*`+
+		`d\.OnTextOf\("quantity", exml\.AssignInt\(&v\.Quantity, 10, 64, 0\)\).*`+
+		`d\.OnText\(exml\.AssignFloat\(&v\.Text, 64, 0\)\).*`)
+}
+
+func (s *CmdSuite) Test_GenOptions(c *check.C) {
+	dir := c.MkDir()
+	output := filepath.Join(dir, "contacts.go")
+
+	status, stdout, stderr := command(SAMPLE, "gen", "-root", "address-book", "-o", output)
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stdout, check.Equals, "")
+	c.Assert(stderr, check.Equals, "")
+	data, err := os.ReadFile(output)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Matches, `(?s).*func DecodeAddressBook\(d \*exml\.Decoder, v \*AddressBook\) \{.*`)
+
+	status, _, stderr = command(SAMPLE, "gen", "-root", "contact")
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Equals, "exml: no root element with attributes or children\n")
+
+	status, _, stderr = command(SAMPLE, "gen", "-package", "not a name")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Matches, "usage: exml gen (?s:.*)")
+
+	schema := writeFile(c, dir, "broken.xsd", []byte(ORDER_SCHEMA))
+	status, _, stderr = command("", "gen", schema)
+	c.Assert(status, check.Equals, 1)
+	missing := filepath.Join(dir, "common", "common.xsd")
+	c.Assert(stderr, check.Equals, missing+": open "+missing+": no such file or directory\n")
+}
+
+func (s *CmdSuite) Test_GoName(c *check.C) {
+	for name, expected := range map[string]string{
+		"first-name":   "FirstName",
+		"schemeID":     "SchemeID",
+		"ID":           "ID",
+		"item_url":     "ItemURL",
+		"HTTPServer":   "HTTPServer",
+		"2nd":          "X2nd",
+		"xml:lang":     "XMLLang",
+		"address-book": "AddressBook",
+	} {
+		c.Assert(goName(name), check.Equals, expected)
+	}
+
+	for word, expected := range map[string]string{
+		"Contact": "Contacts",
+		"Address": "Addresses",
+		"Box":     "Boxes",
+		"Entry":   "Entries",
+		"Day":     "Days",
+		"ID":      "IDs",
+	} {
+		c.Assert(plural(word), check.Equals, expected)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/lucsky/go-exml.v3"
+)
+
+const getUsage = `usage: exml get [-xml] [-0 | -json] PATH [FILE...]
+
+Prints the text of the elements matching PATH, which uses the grammar of
+Decoder.On, or the value of an attribute when the last step of PATH is
+@name. Elements without text are skipped.
+
+flags:
+`
+
+// get runs the get command.
+func get(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, getUsage)
+		flags.PrintDefaults()
+	}
+	outer := flags.Bool("xml", false, "print the outer XML of the matching elements")
+	nul := flags.Bool("0", false, "terminate the values with NUL instead of newline")
+	jsonLines := flags.Bool("json", false, "print a JSON object with the file, line and value of each match")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	q := &query{outer: *outer, nul: *nul, json: *jsonLines}
+	if flags.NArg() == 0 || !q.parse(flags.Arg(0)) || (q.nul && q.json) || (q.outer && q.attr != "") {
+		flags.Usage()
+		return 2
+	}
+
+	out := bufio.NewWriter(stdout)
+	q.out = out
+	ok := eachInput(flags.Args()[1:], stdin, q.run, func(name string, err error) {
+		out.Flush()
+		fmt.Fprintln(stderr, diagnostic(name, err))
+	})
+
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(stderr, "exml: %v\n", err)
+		return 1
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// A query prints the matches of a path in inputs.
+type query struct {
+	path  string
+	attr  string
+	outer bool
+	nul   bool
+	json  bool
+	out   *bufio.Writer
+}
+
+// parse splits a path into the path of the elements and the attribute
+// name of its last step, if any.
+func (q *query) parse(path string) bool {
+	q.path = path
+	if i := strings.LastIndexByte(path, '/'); strings.HasPrefix(path[i+1:], "@") {
+		q.path, q.attr = path[:max(i, 0)], path[i+2:]
+		return q.path != "" && q.attr != ""
+	}
+
+	return path != ""
+}
+
+// run prints the matches of the query in an input.
+func (q *query) run(name string, r io.Reader) error {
+	xd := xml.NewDecoder(exml.NewUTF8Reader(r))
+	xd.CharsetReader = exml.CharsetReader
+
+	var capture *outerXML
+	tr := exml.Filter(xd, func(d *exml.Decoder) {
+		d.On(q.path, func(attrs exml.Attrs) {
+			line, _ := xd.InputPos()
+			switch {
+			case q.attr != "":
+				if value, ok := attrs.Get(q.attr); ok {
+					q.print(name, line, value)
+				}
+			case q.outer:
+				if capture == nil {
+					capture = &outerXML{line: line}
+				}
+			default:
+				d.OnText(func(text exml.CharData) {
+					q.print(name, line, string(text))
+				})
+			}
+		})
+	})
+
+	scopes := &namespaces{}
+	for {
+		t, err := tr.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if capture != nil && capture.write(t, scopes) {
+			q.print(name, capture.line, capture.buf.String())
+			capture = nil
+		}
+		scopes.track(t)
+	}
+}
+
+// print prints a value matched in an input.
+func (q *query) print(name string, line int, value string) {
+	switch {
+	case q.json:
+		encoder := json.NewEncoder(q.out)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(struct {
+			File  string `json:"file"`
+			Line  int    `json:"line"`
+			Value string `json:"value"`
+		}{name, line, value})
+	case q.nul:
+		q.out.WriteString(value)
+		q.out.WriteByte(0)
+	default:
+		q.out.WriteString(value)
+		q.out.WriteByte('\n')
+	}
+}
+
+// namespaces tracks the namespace declarations of the open elements.
+type namespaces struct {
+	decls []exml.Attrs
+}
+
+func (n *namespaces) track(t xml.Token) {
+	switch t := t.(type) {
+	case xml.StartElement:
+		n.decls = append(n.decls, exml.Attrs(t.Attr).NamespaceDecls())
+	case xml.EndElement:
+		n.decls = n.decls[:len(n.decls)-1]
+	}
+}
+
+// An outerXML writes the outer XML of an element.
+type outerXML struct {
+	line  int
+	depth int
+	buf   bytes.Buffer
+	enc   *exml.Encoder
+}
+
+// write writes a token of the element, or the element itself, and returns
+// true when the element is over. The element gets the namespace
+// declarations of its ancestors so that it stands on its own.
+func (o *outerXML) write(t xml.Token, scopes *namespaces) bool {
+	switch t := t.(type) {
+	case xml.StartElement:
+		if o.depth == 0 {
+			o.enc = exml.NewEncoder(&o.buf)
+			t.Attr = append(inherited(scopes, t.Attr), t.Attr...)
+		}
+		o.depth++
+		o.enc.EncodeToken(t)
+
+	case xml.EndElement:
+		o.depth--
+		o.enc.EncodeToken(t)
+		if o.depth == 0 {
+			o.enc.Flush()
+			return true
+		}
+
+	default:
+		// The text preceding the element is forwarded after its start
+		// tag was dispatched.
+		if o.depth > 0 {
+			o.enc.EncodeToken(t)
+		}
+	}
+
+	return false
+}
+
+// inherited returns the declarations in scope of an element with the
+// passed attributes which it does not make itself, innermost first.
+func inherited(scopes *namespaces, attrs []xml.Attr) []xml.Attr {
+	declared := map[xml.Name]bool{}
+	for _, attr := range exml.Attrs(attrs).NamespaceDecls() {
+		declared[attr.Name] = true
+	}
+
+	var decls []xml.Attr
+	for i := len(scopes.decls) - 1; i >= 0; i-- {
+		for _, attr := range scopes.decls[i] {
+			if declared[attr.Name] {
+				continue
+			}
+			declared[attr.Name] = true
+			if attr.Value != "" {
+				decls = append(decls, attr)
+			}
+		}
+	}
+
+	return decls
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"gopkg.in/check.v1"
+)
+
+const FEED = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+    <entry id="1">
+        <title>First &amp; foremost</title>
+        <media:thumbnail url="a.png"/>
+    </entry>
+    <entry id="2">
+        <title></title>
+    </entry>
+    <entry id="3">
+        <title>Third
+line</title>
+    </entry>
+</feed>`
+
+func (s *CmdSuite) Test_GetText(c *check.C) {
+	status, stdout, stderr := command(FEED, "get", "feed/entry/title")
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stderr, check.Equals, "")
+	c.Assert(stdout, check.Equals, "First & foremost\nThird\nline\n")
+
+	_, stdout, _ = command(FEED, "get", "-0", "title")
+	c.Assert(stdout, check.Equals, "First & foremost\x00Third\nline\x00")
+
+	_, stdout, _ = command(FEED, "get", "-json", "title")
+	c.Assert(stdout, check.Equals, ""+
+		`{"file":"-","line":4,"value":"First & foremost"}`+"\n"+
+		`{"file":"-","line":11,"value":"Third\nline"}`+"\n")
+}
+
+func (s *CmdSuite) Test_GetAttributes(c *check.C) {
+	_, stdout, _ := command(FEED, "get", "entry/@id")
+	c.Assert(stdout, check.Equals, "1\n2\n3\n")
+
+	_, stdout, _ = command(FEED, "get", "thumbnail/@url")
+	c.Assert(stdout, check.Equals, "a.png\n")
+}
+
+func (s *CmdSuite) Test_GetXML(c *check.C) {
+	_, stdout, _ := command(FEED, "get", "-xml", "feed/entry")
+	c.Assert(stdout, check.Equals, ""+
+		`<entry xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" id="1">`+"\n"+
+		`        <title>First &amp; foremost</title>`+"\n"+
+		`        <media:thumbnail url="a.png"></media:thumbnail>`+"\n"+
+		`    </entry>`+"\n"+
+		`<entry xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" id="2">`+"\n"+
+		`        <title></title>`+"\n"+
+		`    </entry>`+"\n"+
+		`<entry xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" id="3">`+"\n"+
+		`        <title>Third`+"\n"+
+		`line</title>`+"\n"+
+		`    </entry>`+"\n")
+}
+
+func (s *CmdSuite) Test_GetUsage(c *check.C) {
+	for _, args := range [][]string{
+		{"get"},
+		{"get", "@id"},
+		{"get", "entry/@"},
+		{"get", "-xml", "entry/@id"},
+		{"get", "-0", "-json", "entry"},
+		{"get", "-unknown", "entry"},
+	} {
+		status, _, stderr := command(FEED, args...)
+		c.Assert(status, check.Equals, 2, check.Commentf("%v", args))
+		c.Assert(stderr, check.Matches, "(?s:.*)usage: exml get (?s:.*)")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path"
+	"strings"
+
+	"gopkg.in/lucsky/go-exml.v3"
+)
+
+// modelFromSamples infers a model from sample documents. The elements
+// with the same name share a struct, which has the attributes and children
+// found for all of them. A child is repeated when it occurs more than once
+// in an element of a sample.
+func modelFromSamples(names []string, stdin io.Reader, root string, report func(name string, err error)) (*goModel, error) {
+	s := &sampler{paths: map[string]*sampledPath{}}
+	if !eachInput(names, stdin, s.sample, report) {
+		return nil, errReported
+	}
+
+	// The elements with attributes or children are populated into structs.
+	complex := map[string]bool{}
+	for _, p := range s.order {
+		if len(p.attrs) > 0 {
+			complex[path.Base(p.path)] = true
+		}
+		if parent, _, nested := cutLast(p.path); nested {
+			complex[path.Base(parent)] = true
+		}
+	}
+
+	m := newModel()
+	structs := map[string]*goStruct{}
+	structOf := func(name string) *goStruct {
+		s := structs[name]
+		if s == nil {
+			s = m.newStruct(name, name+" elements")
+			structs[name] = s
+		}
+		return s
+	}
+
+	for _, p := range s.order {
+		parent, name, nested := cutLast(p.path)
+		if !nested {
+			if !complex[name] || (root != "" && name != root) {
+				continue
+			}
+			m.roots = append(m.roots, goRoot{element: name, s: structOf(name)})
+		}
+
+		if complex[name] {
+			s := structOf(name)
+			for _, a := range p.attrs {
+				s.addScalar(attrField, a.name, scalarOf(a.types), false)
+			}
+			if len(p.text) > 0 {
+				s.addScalar(textField, "", scalarOf(p.text), false)
+			}
+		}
+
+		if !nested {
+			continue
+		}
+
+		ps := structOf(path.Base(parent))
+		if complex[name] {
+			ps.addStruct(name, structOf(name), p.repeated)
+		} else {
+			ps.addScalar(childField, name, scalarOf(p.text), p.repeated)
+		}
+	}
+
+	return m, nil
+}
+
+// A sampler collects the element paths of sample documents.
+type sampler struct {
+	paths map[string]*sampledPath
+	order []*sampledPath
+	open  []*sampledElement
+}
+
+// A sampledPath is an element path of the samples.
+type sampledPath struct {
+	path     string
+	repeated bool
+	attrs    []*sampledAttr
+	text     map[exml.ValueType]int64
+}
+
+// A sampledAttr is an attribute of the elements of a path.
+type sampledAttr struct {
+	name  string
+	types map[exml.ValueType]int64
+}
+
+// A sampledElement is an open element of a sample.
+type sampledElement struct {
+	path     *sampledPath
+	text     []byte
+	children map[string]int
+}
+
+// sample collects the paths of a sample document.
+func (s *sampler) sample(name string, r io.Reader) error {
+	xd := xml.NewDecoder(exml.NewUTF8Reader(r))
+	xd.CharsetReader = exml.CharsetReader
+	s.open = s.open[:0]
+
+	for {
+		tok, err := xd.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			s.start(t)
+
+		case xml.CharData:
+			if n := len(s.open); n > 0 {
+				s.open[n-1].text = append(s.open[n-1].text, t...)
+			}
+
+		case xml.EndElement:
+			n := len(s.open) - 1
+			e := s.open[n]
+			s.open = s.open[:n]
+			if text := bytes.TrimSpace(e.text); len(text) > 0 {
+				e.path.text[exml.InferType(string(text))]++
+			}
+		}
+	}
+}
+
+func (s *sampler) start(t xml.StartElement) {
+	var parent *sampledElement
+	name := t.Name.Local
+	p := name
+	if n := len(s.open); n > 0 {
+		parent = s.open[n-1]
+		p = parent.path.path + "/" + name
+	}
+
+	sp := s.paths[p]
+	if sp == nil {
+		sp = &sampledPath{path: p, text: map[exml.ValueType]int64{}}
+		s.paths[p] = sp
+		s.order = append(s.order, sp)
+	}
+	if parent != nil {
+		parent.children[name]++
+		sp.repeated = sp.repeated || parent.children[name] > 1
+	}
+	s.open = append(s.open, &sampledElement{path: sp, children: map[string]int{}})
+
+attrs:
+	for _, attr := range exml.Attrs(t.Attr).WithoutNamespaceDecls() {
+		for _, a := range sp.attrs {
+			if a.name == attr.Name.Local {
+				a.types[exml.InferType(attr.Value)]++
+				continue attrs
+			}
+		}
+		a := &sampledAttr{name: attr.Name.Local, types: map[exml.ValueType]int64{}}
+		a.types[exml.InferType(attr.Value)]++
+		sp.attrs = append(sp.attrs, a)
+	}
+}
+
+// scalarOf returns the Go type which can hold values of the passed types.
+func scalarOf(types map[exml.ValueType]int64) string {
+	scalar := ""
+	for t := range types {
+		s := "string"
+		switch t {
+		case exml.IntValue:
+			s = "int64"
+		case exml.FloatValue:
+			s = "float64"
+		case exml.BoolValue:
+			s = "bool"
+		}
+
+		if scalar == "" {
+			scalar = s
+		} else {
+			scalar = widen(scalar, s)
+		}
+	}
+
+	if scalar == "" {
+		return "string"
+	}
+	return scalar
+}
+
+// cutLast splits a path before its last step.
+func cutLast(p string) (parent string, name string, nested bool) {
+	i := strings.LastIndexByte(p, '/')
+	if i < 0 {
+		return "", p, false
+	}
+	return p[:i], p[i+1:], true
+}
@@ -0,0 +1,138 @@
+// Command exml queries XML documents using the paths of the exml package,
+// and generates the code decoding them.
+//
+// Usage:
+//
+//	exml get [-xml] [-0 | -json] PATH [FILE...]
+//	exml stats [-json] [FILE...]
+//	exml gen [-package NAME] [-root ELEMENT] [-o FILE] [FILE...]
+//
+// Inputs are the passed files, which may be glob patterns, or the standard
+// input when none is passed or for "-". Gzip compressed inputs are detected
+// and decompressed. Parse errors are reported as file:line diagnostics, the
+// remaining inputs being processed, and make the command exit with status
+// 1.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const usage = `usage: exml <command> [arguments]
+
+commands:
+  get     print the text, attributes or XML of the elements matching a path
+  stats   print the element paths, attributes and value types of documents
+  gen     generate Go structs and exml handlers from an XSD schema or samples
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command with the passed arguments and returns the exit
+// status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "get":
+		return get(args[1:], stdin, stdout, stderr)
+	case "stats":
+		return stats(args[1:], stdin, stdout, stderr)
+	case "gen":
+		return gen(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "exml: unknown command %q\n%s", args[0], usage)
+	return 2
+}
+
+// eachInput calls process with each input designated by the passed names,
+// expanding glob patterns, or with the standard input when there is none.
+// Failures are passed to report, and false is returned when there was any.
+func eachInput(names []string, stdin io.Reader, process func(name string, r io.Reader) error, report func(name string, err error)) bool {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	ok := true
+	for _, pattern := range names {
+		files := []string{pattern}
+		if pattern != "-" && strings.ContainsAny(pattern, "*?[") {
+			matches, err := filepath.Glob(pattern)
+			if err == nil && len(matches) == 0 {
+				err = errors.New("no matching files")
+			}
+			if err != nil {
+				report(pattern, err)
+				ok = false
+				continue
+			}
+			files = matches
+		}
+
+		for _, name := range files {
+			if err := processInput(name, stdin, process); err != nil {
+				report(name, err)
+				ok = false
+			}
+		}
+	}
+
+	return ok
+}
+
+// processInput opens an input, decompressing it when it is gzip
+// compressed, and passes it to process.
+func processInput(name string, stdin io.Reader, process func(name string, r io.Reader) error) error {
+	var r io.Reader = stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1F && magic[1] == 0x8B {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return process(name, zr)
+	}
+
+	return process(name, br)
+}
+
+// diagnostic formats an error reported for an input.
+func diagnostic(name string, err error) string {
+	if name == "-" {
+		name = "<stdin>"
+	}
+
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Sprintf("%s:%d: %s", name, syntaxErr.Line, syntaxErr.Msg)
+	}
+
+	return fmt.Sprintf("%s: %v", name, err)
+}
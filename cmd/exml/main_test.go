@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { check.TestingT(t) }
+
+type CmdSuite struct{}
+
+var _ = check.Suite(&CmdSuite{})
+
+// command runs the command and returns its exit status and outputs.
+func command(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func writeFile(c *check.C, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	c.Assert(os.WriteFile(path, data, 0o644), check.IsNil)
+	return path
+}
+
+func gzipped(c *check.C, data string) []byte {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	_, err := zw.Write([]byte(data))
+	c.Assert(err, check.IsNil)
+	c.Assert(zw.Close(), check.IsNil)
+	return b.Bytes()
+}
+
+func (s *CmdSuite) Test_Usage(c *check.C) {
+	status, _, stderr := command("")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Matches, "usage: exml (?s:.*)")
+
+	status, _, stderr = command("", "frobnicate")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Matches, `exml: unknown command "frobnicate"(?s:.*)`)
+
+	status, stdout, _ := command("", "help")
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stdout, check.Matches, "usage: exml (?s:.*)")
+}
+
+func (s *CmdSuite) Test_Inputs(c *check.C) {
+	dir := c.MkDir()
+	writeFile(c, dir, "a.xml", []byte(`<feed><entry><title>A</title></entry></feed>`))
+	writeFile(c, dir, "b.xml", gzipped(c, `<feed><entry><title>B</title></entry></feed>`))
+	writeFile(c, dir, "c.xml", []byte("<feed>\n<entry><title>C</title>\n</feed>"))
+
+	status, stdout, stderr := command("", "get", "title", filepath.Join(dir, "*.xml"), filepath.Join(dir, "missing.xml"), filepath.Join(dir, "*.json"))
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stdout, check.Equals, "A\nB\nC\n")
+	c.Assert(stderr, check.Equals, ""+
+		filepath.Join(dir, "c.xml")+":3: element <entry> closed by </feed>\n"+
+		filepath.Join(dir, "missing.xml")+": open "+filepath.Join(dir, "missing.xml")+": no such file or directory\n"+
+		filepath.Join(dir, "*.json")+": no matching files\n")
+
+	status, stdout, _ = command(string(gzipped(c, `<a><b>stdin</b></a>`)), "get", "b", "-")
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stdout, check.Equals, "stdin\n")
+}
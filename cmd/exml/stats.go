@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/lucsky/go-exml.v3"
+)
+
+const statsUsage = `usage: exml stats [-json] [FILE...]
+
+Prints the distinct element paths of each input with their counts, their
+attributes and text values with lengths and inferred types, and the
+distinct element names with the depths at which they occur.
+
+flags:
+`
+
+// stats runs the stats command.
+func stats(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, statsUsage)
+		flags.PrintDefaults()
+	}
+	jsonOutput := flags.Bool("json", false, "print a JSON object with the profile of each input")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	out := bufio.NewWriter(stdout)
+	first := true
+	ok := eachInput(flags.Args(), stdin, func(name string, r io.Reader) error {
+		profile, err := exml.Profile(r)
+		if *jsonOutput {
+			encoder := json.NewEncoder(out)
+			encoder.SetEscapeHTML(false)
+			encoder.Encode(struct {
+				File string `json:"file"`
+				*exml.DocumentProfile
+			}{name, profile})
+		} else {
+			if !first {
+				out.WriteByte('\n')
+			}
+			first = false
+			if flags.NArg() > 1 {
+				fmt.Fprintf(out, "%s:\n", name)
+			}
+			writeProfile(out, profile)
+		}
+		return err
+	}, func(name string, err error) {
+		out.Flush()
+		fmt.Fprintln(stderr, diagnostic(name, err))
+	})
+
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(stderr, "exml: %v\n", err)
+		return 1
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// writeProfile writes a profile as text tables.
+func writeProfile(w io.Writer, profile *exml.DocumentProfile) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tCOUNT\tLENGTH\tTYPES")
+	for _, p := range profile.Paths {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", p.Path, p.Count, lengths(p.Text), types(p.Text))
+		for _, a := range p.Attrs {
+			fmt.Fprintf(tw, "  @%s\t%d\t%s\t%s\n", a.Name, a.Count, lengths(a.ValueProfile), types(a.ValueProfile))
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(tw, "ELEMENT\tCOUNT\tDEPTH")
+	for _, e := range profile.Elements {
+		depth := fmt.Sprint(e.MinDepth)
+		if e.MaxDepth != e.MinDepth {
+			depth += fmt.Sprintf("..%d", e.MaxDepth)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", e.Name, e.Count, depth)
+	}
+	tw.Flush()
+}
+
+// lengths formats the lengths of values as min..max and their average.
+func lengths(v exml.ValueProfile) string {
+	if v.Count == 0 {
+		return "-"
+	}
+	if v.MinLength == v.MaxLength {
+		return fmt.Sprint(v.MinLength)
+	}
+
+	return fmt.Sprintf("%d..%d (avg %.1f)", v.MinLength, v.MaxLength, float64(v.TotalLength)/float64(v.Count))
+}
+
+// types formats the inferred types of values, the most frequent first.
+func types(v exml.ValueProfile) string {
+	if v.Count == 0 {
+		return "-"
+	}
+
+	sorted := slices.SortedFunc(maps.Keys(v.Types), func(a, b exml.ValueType) int {
+		return cmp.Or(cmp.Compare(v.Types[b], v.Types[a]), cmp.Compare(a, b))
+	})
+	if len(sorted) == 1 {
+		return sorted[0].String()
+	}
+
+	parts := make([]string, len(sorted))
+	for i, t := range sorted {
+		parts[i] = fmt.Sprintf("%s:%d", t, v.Types[t])
+	}
+	return strings.Join(parts, " ")
+}
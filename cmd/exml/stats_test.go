@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const VENDOR = `<catalog>
+    <item sku="A-1" added="2024-03-01"><price>12.50</price><stock>3</stock></item>
+    <item sku="B-22"><price>7</price><stock>none</stock><item sku="C"/></item>
+</catalog>`
+
+func (s *CmdSuite) Test_Stats(c *check.C) {
+	status, stdout, stderr := command(VENDOR, "stats")
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stderr, check.Equals, "")
+	c.Assert(stdout, check.Equals, `PATH                COUNT  LENGTH          TYPES
+catalog             1      -               -
+catalog/item        2      -               -
+  @sku              2      3..4 (avg 3.5)  string
+  @added            1      10              date
+catalog/item/price  2      1..5 (avg 3.0)  int:1 float:1
+catalog/item/stock  2      1..4 (avg 2.5)  string:1 int:1
+catalog/item/item   1      -               -
+  @sku              1      1               string
+
+ELEMENT  COUNT  DEPTH
+catalog  1      1
+item     3      2..3
+price    2      3
+stock    2      3
+`)
+}
+
+func (s *CmdSuite) Test_StatsFiles(c *check.C) {
+	dir := c.MkDir()
+	writeFile(c, dir, "a.xml", []byte(`<a x="1"/>`))
+	writeFile(c, dir, "b.xml.gz", gzipped(c, "<b>\n<c></b>"))
+
+	status, stdout, stderr := command("", "stats", "-json", filepath.Join(dir, "*"))
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Equals, filepath.Join(dir, "b.xml.gz")+":2: element <c> closed by </b>\n")
+
+	decoder := json.NewDecoder(strings.NewReader(stdout))
+	for _, expected := range []string{"a", "b"} {
+		var v struct {
+			File  string `json:"file"`
+			Paths []struct {
+				Path string `json:"path"`
+			} `json:"paths"`
+		}
+		c.Assert(decoder.Decode(&v), check.IsNil)
+		c.Assert(filepath.Base(v.File), check.Matches, expected+`\.xml.*`)
+		c.Assert(v.Paths[0].Path, check.Equals, expected)
+	}
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/lucsky/go-exml.v3"
+)
+
+// xsdNamespace is the namespace of the schema elements and builtin types.
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema"
+
+// builtinTypes are the Go types of the builtin types which are not read as
+// strings.
+var builtinTypes = map[string]string{
+	"integer": "int64", "nonNegativeInteger": "int64", "positiveInteger": "int64",
+	"nonPositiveInteger": "int64", "negativeInteger": "int64", "long": "int64",
+	"int": "int64", "short": "int64", "byte": "int64", "unsignedLong": "int64",
+	"unsignedInt": "int64", "unsignedShort": "int64", "unsignedByte": "int64",
+	"decimal": "float64", "float": "float64", "double": "float64",
+	"boolean": "bool",
+}
+
+// modelFromSchema builds a model from the global elements of XSD schemas.
+// Includes and imports are loaded from the files designated by their
+// relative schema locations. Sequences, choices and groups are flattened
+// into the fields of the structs, which are shared by the elements of a
+// named type, and values of unknown types are read as strings.
+func modelFromSchema(names []string, stdin io.Reader, root string, report func(name string, err error)) (*goModel, error) {
+	s := &xsdSchemas{
+		elements:   map[xsdName]*xsdElement{},
+		types:      map[xsdName]*xsdType{},
+		groups:     map[xsdName]*xsdType{},
+		attrGroups: map[xsdName]*xsdType{},
+		attrs:      map[xsdName]*xsdAttr{},
+		loaded:     map[string]bool{},
+		report:     report,
+	}
+	ok := eachInput(names, stdin, func(name string, r io.Reader) error {
+		return s.parse(name, r, true, "")
+	}, report)
+	if !ok || s.failed {
+		return nil, errReported
+	}
+
+	c := &xsdConverter{s: s, m: newModel(), contents: map[*xsdType]*xsdContent{}, structs: map[*xsdType]*goStruct{}}
+	for _, e := range s.roots {
+		if root != "" && e.name != root {
+			continue
+		}
+		if child := c.resolve(e); c.isStruct(child) {
+			c.m.roots = append(c.m.roots, goRoot{element: child.name, s: c.structOf(child.t, child.name)})
+		}
+	}
+
+	return c.m, nil
+}
+
+// An xsdName is a qualified name of a schema component.
+type xsdName struct {
+	space string
+	local string
+}
+
+// xsdSchemas holds the global components of the loaded schemas.
+type xsdSchemas struct {
+	elements   map[xsdName]*xsdElement
+	types      map[xsdName]*xsdType
+	groups     map[xsdName]*xsdType
+	attrGroups map[xsdName]*xsdType
+	attrs      map[xsdName]*xsdAttr
+	roots      []*xsdElement
+	loaded     map[string]bool
+	report     func(name string, err error)
+	failed     bool
+}
+
+// An xsdElement is an element declaration or reference.
+type xsdElement struct {
+	name     string
+	ref      xsdName
+	typ      xsdName
+	inline   *xsdType
+	repeated bool
+}
+
+// An xsdAttr is an attribute declaration or reference.
+type xsdAttr struct {
+	name       string
+	ref        xsdName
+	typ        xsdName
+	inline     *xsdType
+	prohibited bool
+}
+
+// An xsdType is a simple or complex type, a model group or an attribute
+// group.
+type xsdType struct {
+	name          xsdName
+	simple        bool
+	simpleContent bool
+	mixed         bool
+	base          xsdName
+	extension     bool
+	particles     []*xsdParticle
+	attrs         []*xsdAttr
+	attrGroups    []xsdName
+}
+
+// An xsdParticle is an element or a reference to a model group.
+type xsdParticle struct {
+	element  *xsdElement
+	group    xsdName
+	repeated bool
+}
+
+// An xsdLocation is an included or imported schema.
+type xsdLocation struct {
+	path      string
+	chameleon string
+}
+
+// parse reads the components of a schema, then loads the schemas it
+// includes and imports. Schemas without a target namespace take the one
+// of the schema including them, passed as chameleon.
+func (s *xsdSchemas) parse(name string, r io.Reader, main bool, chameleon string) error {
+	dir := "."
+	if name != "-" {
+		dir = filepath.Dir(name)
+		s.loaded[filepath.Clean(name)] = true
+	}
+
+	d := exml.NewDecoder(r)
+	p := &xsdParser{d: d, scope: map[string]string{}, chameleon: chameleon}
+	var locations []xsdLocation
+	d.On("schema", func(attrs exml.Attrs) {
+		for _, attr := range attrs {
+			switch {
+			case attr.Name.Space == "xmlns":
+				p.scope[attr.Name.Local] = attr.Value
+			case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+				p.scope[""] = attr.Value
+			}
+		}
+		p.tns = attrs.GetString("targetNamespace", chameleon)
+
+		d.On("include", func(attrs exml.Attrs) {
+			locations = append(locations, xsdLocation{attrs.GetString("schemaLocation", ""), p.tns})
+		})
+		d.On("import", func(attrs exml.Attrs) {
+			locations = append(locations, xsdLocation{attrs.GetString("schemaLocation", ""), ""})
+		})
+		d.On("element", func(attrs exml.Attrs) {
+			e := p.element(attrs, false)
+			s.elements[xsdName{p.tns, e.name}] = e
+			if main {
+				s.roots = append(s.roots, e)
+			}
+		})
+		d.On("complexType", func(attrs exml.Attrs) {
+			t := p.complexType(attrs)
+			t.name = xsdName{p.tns, attrs.GetString("name", "")}
+			s.types[t.name] = t
+		})
+		d.On("simpleType", func(attrs exml.Attrs) {
+			t := p.simpleType()
+			t.name = xsdName{p.tns, attrs.GetString("name", "")}
+			s.types[t.name] = t
+		})
+		d.On("group", func(attrs exml.Attrs) {
+			g := &xsdType{}
+			s.groups[xsdName{p.tns, attrs.GetString("name", "")}] = g
+			p.particles(&g.particles, false)
+		})
+		d.On("attributeGroup", func(attrs exml.Attrs) {
+			g := &xsdType{}
+			s.attrGroups[xsdName{p.tns, attrs.GetString("name", "")}] = g
+			p.attributes(g)
+		})
+		d.On("attribute", func(attrs exml.Attrs) {
+			a := p.attribute(attrs)
+			s.attrs[xsdName{p.tns, a.name}] = a
+		})
+	})
+
+	if err := d.Run(); err != nil {
+		return err
+	}
+
+	for _, loc := range locations {
+		if loc.path == "" || strings.Contains(loc.path, "://") {
+			continue
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(loc.path))
+		if s.loaded[path] {
+			continue
+		}
+		err := processInput(path, nil, func(name string, r io.Reader) error {
+			return s.parse(name, r, false, loc.chameleon)
+		})
+		if err != nil {
+			s.report(path, err)
+			s.failed = true
+		}
+	}
+
+	return nil
+}
+
+// An xsdParser registers the handlers reading the components of a schema.
+type xsdParser struct {
+	d         *exml.Decoder
+	scope     map[string]string
+	tns       string
+	chameleon string
+}
+
+// qname resolves a qualified name using the namespace declarations of the
+// schema.
+func (p *xsdParser) qname(value string) xsdName {
+	if value == "" {
+		return xsdName{}
+	}
+
+	prefix, local, found := strings.Cut(value, ":")
+	if !found {
+		prefix, local = "", value
+	}
+	space := p.scope[prefix]
+	if space == "" {
+		space = p.chameleon
+	}
+	return xsdName{space, local}
+}
+
+// element reads an element declaration and registers the handlers reading
+// its anonymous type.
+func (p *xsdParser) element(attrs exml.Attrs, repeated bool) *xsdElement {
+	e := &xsdElement{
+		name:     attrs.GetString("name", ""),
+		ref:      p.qname(attrs.GetString("ref", "")),
+		typ:      p.qname(attrs.GetString("type", "")),
+		repeated: repeated || repeats(attrs),
+	}
+
+	p.d.On("complexType", func(attrs exml.Attrs) {
+		e.inline = p.complexType(attrs)
+	})
+	p.d.On("simpleType", func(exml.Attrs) {
+		e.inline = p.simpleType()
+	})
+	return e
+}
+
+// complexType registers the handlers reading a complex type.
+func (p *xsdParser) complexType(attrs exml.Attrs) *xsdType {
+	t := &xsdType{mixed: attrs.GetBool("mixed", false)}
+	p.particles(&t.particles, false)
+	p.attributes(t)
+
+	p.d.On("simpleContent", func(exml.Attrs) {
+		t.simpleContent = true
+		p.derivation(t)
+	})
+	p.d.On("complexContent", func(attrs exml.Attrs) {
+		t.mixed = attrs.GetBool("mixed", t.mixed)
+		p.derivation(t)
+	})
+	return t
+}
+
+// derivation registers the handlers reading the extension or restriction
+// of the base of a type.
+func (p *xsdParser) derivation(t *xsdType) {
+	p.d.On("extension", func(attrs exml.Attrs) {
+		t.base, t.extension = p.qname(attrs.GetString("base", "")), true
+		p.particles(&t.particles, false)
+		p.attributes(t)
+	})
+	p.d.On("restriction", func(attrs exml.Attrs) {
+		t.base = p.qname(attrs.GetString("base", ""))
+		p.particles(&t.particles, false)
+		p.attributes(t)
+	})
+}
+
+// simpleType registers the handlers reading a simple type. Lists and
+// unions have no base and are read as strings.
+func (p *xsdParser) simpleType() *xsdType {
+	t := &xsdType{simple: true}
+	p.d.On("restriction", func(attrs exml.Attrs) {
+		t.base = p.qname(attrs.GetString("base", ""))
+	})
+	return t
+}
+
+// particles registers the handlers reading the elements and group
+// references of the compositors of a type or group, which are repeated
+// when a compositor containing them is.
+func (p *xsdParser) particles(particles *[]*xsdParticle, repeated bool) {
+	for _, compositor := range []string{"sequence", "choice", "all"} {
+		p.d.On(compositor, func(attrs exml.Attrs) {
+			repeated := repeated || repeats(attrs)
+			p.d.On("element", func(attrs exml.Attrs) {
+				*particles = append(*particles, &xsdParticle{element: p.element(attrs, repeated)})
+			})
+			p.particles(particles, repeated)
+		})
+	}
+
+	p.d.On("group", func(attrs exml.Attrs) {
+		*particles = append(*particles, &xsdParticle{
+			group:    p.qname(attrs.GetString("ref", "")),
+			repeated: repeated || repeats(attrs),
+		})
+	})
+}
+
+// attributes registers the handlers reading the attributes and attribute
+// group references of a type or attribute group.
+func (p *xsdParser) attributes(t *xsdType) {
+	p.d.On("attribute", func(attrs exml.Attrs) {
+		t.attrs = append(t.attrs, p.attribute(attrs))
+	})
+	p.d.On("attributeGroup", func(attrs exml.Attrs) {
+		t.attrGroups = append(t.attrGroups, p.qname(attrs.GetString("ref", "")))
+	})
+}
+
+// attribute reads an attribute declaration and registers the handler
+// reading its anonymous type.
+func (p *xsdParser) attribute(attrs exml.Attrs) *xsdAttr {
+	a := &xsdAttr{
+		name:       attrs.GetString("name", ""),
+		ref:        p.qname(attrs.GetString("ref", "")),
+		typ:        p.qname(attrs.GetString("type", "")),
+		prohibited: attrs.GetString("use", "") == "prohibited",
+	}
+
+	p.d.On("simpleType", func(exml.Attrs) {
+		a.inline = p.simpleType()
+	})
+	return a
+}
+
+// repeats returns true when the occurrence constraints of a particle allow
+// more than one occurrence.
+func repeats(attrs exml.Attrs) bool {
+	occurs := attrs.GetString("maxOccurs", "1")
+	return occurs != "1" && occurs != "0"
+}
+
+// An xsdConverter converts the types of schemas to structs.
+type xsdConverter struct {
+	s        *xsdSchemas
+	m        *goModel
+	contents map[*xsdType]*xsdContent
+	structs  map[*xsdType]*goStruct
+}
+
+// An xsdContent is the content of a complex type, including the content
+// inherited from its base.
+type xsdContent struct {
+	attrs    []*xsdAttr
+	children []xsdChild
+	text     string
+}
+
+// An xsdChild is a resolved element declaration.
+type xsdChild struct {
+	name     string
+	t        *xsdType
+	typ      xsdName
+	repeated bool
+}
+
+// resolve follows the reference of an element and looks its type up.
+func (c *xsdConverter) resolve(e *xsdElement) xsdChild {
+	child := xsdChild{name: e.name, repeated: e.repeated}
+	if e.ref != (xsdName{}) {
+		child.name = e.ref.local
+		if e = c.s.elements[e.ref]; e == nil {
+			return child
+		}
+	}
+
+	child.typ = e.typ
+	child.t = e.inline
+	if child.t == nil {
+		child.t = c.s.types[e.typ]
+	}
+	return child
+}
+
+// isStruct returns true when an element has attributes or children.
+func (c *xsdConverter) isStruct(child xsdChild) bool {
+	if child.t == nil || child.t.simple {
+		return false
+	}
+	content := c.content(child.t)
+	return len(content.attrs) > 0 || len(content.children) > 0
+}
+
+// content returns the content of a complex type.
+func (c *xsdConverter) content(t *xsdType) *xsdContent {
+	if content := c.contents[t]; content != nil {
+		return content
+	}
+
+	// Recorded first so that cyclic derivations end.
+	content := &xsdContent{}
+	c.contents[t] = content
+
+	if base := c.s.types[t.base]; base != nil && !base.simple {
+		inherited := c.content(base)
+		content.attrs = append(content.attrs, inherited.attrs...)
+		content.text = inherited.text
+		if t.extension {
+			content.children = append(content.children, inherited.children...)
+		}
+	} else if t.simpleContent {
+		content.text = c.scalar(t.base)
+	}
+	if t.mixed {
+		content.text = "string"
+	}
+
+	content.attrs = c.attributes(content.attrs, t, map[*xsdType]bool{})
+	content.children = c.children(content.children, t.particles, false, map[*xsdType]bool{})
+	return content
+}
+
+// attributes appends the attributes of a type or attribute group to attrs.
+func (c *xsdConverter) attributes(attrs []*xsdAttr, t *xsdType, seen map[*xsdType]bool) []*xsdAttr {
+	seen[t] = true
+	for _, a := range t.attrs {
+		if !a.prohibited {
+			attrs = append(attrs, a)
+		}
+	}
+	for _, name := range t.attrGroups {
+		if g := c.s.attrGroups[name]; g != nil && !seen[g] {
+			attrs = c.attributes(attrs, g, seen)
+		}
+	}
+	return attrs
+}
+
+// children appends the elements of particles to children, flattening the
+// referenced model groups.
+func (c *xsdConverter) children(children []xsdChild, particles []*xsdParticle, repeated bool, seen map[*xsdType]bool) []xsdChild {
+	for _, p := range particles {
+		if p.element != nil {
+			child := c.resolve(p.element)
+			child.repeated = child.repeated || repeated
+			children = append(children, child)
+			continue
+		}
+
+		if g := c.s.groups[p.group]; g != nil && !seen[g] {
+			seen[g] = true
+			children = c.children(children, g.particles, repeated || p.repeated, seen)
+			delete(seen, g)
+		}
+	}
+	return children
+}
+
+// scalar returns the Go type of the values of a simple type.
+func (c *xsdConverter) scalar(name xsdName) string {
+	seen := map[xsdName]bool{}
+	for !seen[name] {
+		seen[name] = true
+		if name.space == xsdNamespace {
+			break
+		}
+
+		t := c.s.types[name]
+		if t == nil || !t.simple {
+			return "string"
+		}
+		name = t.base
+	}
+
+	if scalar, ok := builtinTypes[name.local]; ok && name.space == xsdNamespace {
+		return scalar
+	}
+	return "string"
+}
+
+// attrScalar returns the Go type of the values of an attribute.
+func (c *xsdConverter) attrScalar(a *xsdAttr) string {
+	if a.ref != (xsdName{}) {
+		if a = c.s.attrs[a.ref]; a == nil {
+			return "string"
+		}
+	}
+
+	if a.inline != nil {
+		return c.scalar(a.inline.base)
+	}
+	return c.scalar(a.typ)
+}
+
+// childScalar returns the Go type of the text of an element without
+// attributes or children.
+func (c *xsdConverter) childScalar(child xsdChild) string {
+	switch {
+	case child.t == nil:
+		return c.scalar(child.typ)
+	case child.t.simple:
+		return c.scalar(child.t.base)
+	case !child.t.mixed && c.content(child.t).text != "":
+		return c.content(child.t).text
+	}
+	return "string"
+}
+
+// structOf returns the struct of a complex type, named after the type or,
+// for anonymous types, after the passed element name.
+func (c *xsdConverter) structOf(t *xsdType, element string) *goStruct {
+	if s := c.structs[t]; s != nil {
+		return s
+	}
+
+	var s *goStruct
+	if local := t.name.local; local != "" {
+		name := strings.TrimSuffix(local, "Type")
+		if name == "" {
+			name = local
+		}
+		s = c.m.newStruct(name, "elements of the "+local+" type")
+	} else {
+		s = c.m.newStruct(element, element+" elements")
+	}
+	c.structs[t] = s
+
+	content := c.content(t)
+	for _, a := range content.attrs {
+		name := a.name
+		if a.ref != (xsdName{}) {
+			name = a.ref.local
+		}
+		s.addScalar(attrField, name, c.attrScalar(a), false)
+	}
+	if content.text != "" {
+		s.addScalar(textField, "", content.text, false)
+	}
+	for _, child := range content.children {
+		if c.isStruct(child) {
+			s.addStruct(child.name, c.structOf(child.t, child.name), child.repeated)
+		} else {
+			s.addScalar(childField, child.name, c.childScalar(child), child.repeated)
+		}
+	}
+
+	return s
+}
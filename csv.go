@@ -0,0 +1,189 @@
+package exml
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Column is a column of the table written by ToCSV.
+type Column struct {
+	Header string
+
+	// Path selects the value of the column relatively to the record
+	// element: "pricing/amount" is the text of the amount element of the
+	// pricing element of the record, "@id" is the id attribute of the
+	// record and "pricing/@currency" the currency attribute of its
+	// pricing element. An empty path selects the text of the record.
+	Path string
+
+	// Missing is written when the record has no value for the column.
+	Missing string
+
+	// Join separates the values of the column when the record has several
+	// of them. When empty, only the first value is written.
+	Join string
+}
+
+// ToCSV writes a row to w for each element of the document read from r
+// matched by recordPath, registered like with On, after a header row. The
+// cells hold the values selected by the passed columns, text being trimmed
+// like for text callbacks. Rows are written as records are read, and w is
+// flushed before returning. TSV is written by setting the Comma field of w
+// to '\t'.
+func ToCSV(r io.Reader, w *csv.Writer, recordPath string, columns []Column) error {
+	root := &csvNode{}
+	for i, col := range columns {
+		if err := root.add(col.Path, i); err != nil {
+			return err
+		}
+	}
+
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.Header
+	}
+	if err := w.Write(headers); err != nil {
+		return err
+	}
+
+	t := &csvTable{w: w, columns: columns, values: make([][]string, len(columns))}
+	d := NewDecoder(r)
+	d.OnE(recordPath, func(attrs Attrs) error {
+		if err := t.flush(); err != nil {
+			return err
+		}
+
+		t.open = true
+		root.install(d, t, attrs)
+		return nil
+	})
+
+	err := d.Run()
+	if t.err != nil {
+		return t.err
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = t.flush(); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// A csvNode is an element of the record, or the record itself, holding the
+// values of some columns.
+type csvNode struct {
+	name     string
+	attrs    []csvAttr
+	text     []int
+	children []*csvNode
+}
+
+// A csvAttr is an attribute holding the value of a column.
+type csvAttr struct {
+	name   string
+	column int
+}
+
+// add adds the column with the passed index and relative path to the tree
+// of nodes.
+func (n *csvNode) add(path string, column int) error {
+	if path == "" {
+		n.text = append(n.text, column)
+		return nil
+	}
+
+	step, rest, nested := strings.Cut(path, "/")
+	switch {
+	case step == "":
+		return fmt.Errorf("exml: invalid column path %q", path)
+	case step[0] == '@':
+		if nested || len(step) == 1 {
+			return fmt.Errorf("exml: invalid column path %q", path)
+		}
+		n.attrs = append(n.attrs, csvAttr{name: step[1:], column: column})
+		return nil
+	}
+
+	for _, child := range n.children {
+		if child.name == step {
+			return child.add(rest, column)
+		}
+	}
+
+	child := &csvNode{name: step}
+	n.children = append(n.children, child)
+	if !nested {
+		return child.add("", column)
+	}
+	return child.add(rest, column)
+}
+
+// install records the attribute values of the element of the node, and
+// registers the handlers collecting the values of its text and of the
+// elements it contains.
+func (n *csvNode) install(d *Decoder, t *csvTable, attrs Attrs) {
+	for _, attr := range n.attrs {
+		if value, ok := attrs.Get(attr.name); ok {
+			t.add(attr.column, value)
+		}
+	}
+
+	if len(n.text) > 0 {
+		d.OnText(func(text CharData) {
+			for _, column := range n.text {
+				t.add(column, string(text))
+			}
+		})
+	}
+
+	for _, child := range n.children {
+		d.On(child.name, func(attrs Attrs) {
+			child.install(d, t, attrs)
+		})
+	}
+}
+
+// A csvTable collects the values of the current record.
+type csvTable struct {
+	w       *csv.Writer
+	columns []Column
+	values  [][]string
+	row     []string
+	open    bool
+	err     error
+}
+
+// add adds a value to a column of the current record.
+func (t *csvTable) add(column int, value string) {
+	if len(t.values[column]) > 0 && t.columns[column].Join == "" {
+		return
+	}
+	t.values[column] = append(t.values[column], value)
+}
+
+// flush writes the row of the current record, if any.
+func (t *csvTable) flush() error {
+	if !t.open {
+		return nil
+	}
+
+	t.open = false
+	t.row = t.row[:0]
+	for i, values := range t.values {
+		if len(values) == 0 {
+			t.row = append(t.row, t.columns[i].Missing)
+		} else {
+			t.row = append(t.row, strings.Join(values, t.columns[i].Join))
+		}
+		t.values[i] = values[:0]
+	}
+
+	t.err = t.w.Write(t.row)
+	return t.err
+}
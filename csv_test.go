@@ -0,0 +1,71 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const FEED = `<?xml version="1.0"?>
+<feed>
+    <item id="A-1">
+        <title>Widget, large</title>
+        <pricing currency="EUR"><amount>12.50</amount></pricing>
+        <tag>new</tag>
+        <tag>sale</tag>
+    </item>
+    <item id="A-2">
+        <title>Gadget "Pro"</title>
+        <tag>old</tag>
+    </item>
+    <item>
+        <pricing currency="USD"><amount>3</amount><amount>4</amount></pricing>
+        Clearance
+    </item>
+</feed>`
+
+var feedColumns = []Column{
+	{Header: "sku", Path: "@id", Missing: "?"},
+	{Header: "title", Path: "title"},
+	{Header: "price", Path: "pricing/amount"},
+	{Header: "currency", Path: "pricing/@currency", Missing: "EUR"},
+	{Header: "tags", Path: "tag", Join: "|"},
+	{Header: "note", Path: ""},
+}
+
+func (s *EXMLSuite) Test_ToCSV(c *check.C) {
+	var out bytes.Buffer
+	err := ToCSV(strings.NewReader(FEED), csv.NewWriter(&out), "feed/item", feedColumns)
+	c.Assert(err, check.IsNil)
+	c.Assert(out.String(), check.Equals, `sku,title,price,currency,tags,note
+A-1,"Widget, large",12.50,EUR,new|sale,
+A-2,"Gadget ""Pro""",,EUR,old,
+?,,3,USD,,Clearance
+`)
+}
+
+func (s *EXMLSuite) Test_ToTSV(c *check.C) {
+	var out bytes.Buffer
+	w := csv.NewWriter(&out)
+	w.Comma = '\t'
+	err := ToCSV(strings.NewReader(FEED), w, "item", feedColumns[:3])
+	c.Assert(err, check.IsNil)
+	c.Assert(out.String(), check.Equals, "sku\ttitle\tprice\nA-1\tWidget, large\t12.50\nA-2\t\"Gadget \"\"Pro\"\"\"\t\n?\t\t3\n")
+}
+
+func (s *EXMLSuite) Test_ToCSVErrors(c *check.C) {
+	var out bytes.Buffer
+	for _, path := range []string{"a//b", "@", "@a/b", "/a"} {
+		err := ToCSV(strings.NewReader(FEED), csv.NewWriter(&out), "item", []Column{{Header: "h", Path: path}})
+		c.Assert(err, check.ErrorMatches, "exml: invalid column path .*")
+	}
+	c.Assert(out.Len(), check.Equals, 0)
+
+	err := ToCSV(strings.NewReader(MALFORMED), csv.NewWriter(&out), "item", feedColumns)
+	c.Assert(err, check.NotNil)
+
+	err = ToCSV(bytes.NewReader(largeCatalog(1000)), csv.NewWriter(failingWriter{}), "product", []Column{{Header: "id", Path: "@id"}})
+	c.Assert(err, check.Equals, errCallback)
+}
@@ -0,0 +1,70 @@
+package exml
+
+// OnDocumentStart registers a handler called whenever a root element is
+// encountered, before its own handler is called.
+func (d *Decoder) OnDocumentStart(callback func()) {
+	d.documentStart = callback
+}
+
+// OnDocumentEnd registers a handler called whenever a root element has
+// been closed.
+func (d *Decoder) OnDocumentEnd(callback func()) {
+	d.documentEnd = callback
+}
+
+// MultiDocument controls whether the input is handled as a sequence of
+// independent documents, as found in concatenated exports, logging systems
+// or XMPP streams. In this mode, the handlers are restored to the state
+// they were in when Run was called after each document, which discards
+// the handlers registered from callbacks during the previous document, and
+// the text found between documents is ignored. Each document may start
+// with its own XML declaration. Since the rest of the input is converted
+// to UTF-8 from the first declaration of an encoding other than UTF-8 on,
+// a later document declaring another encoding stops the parsing with an
+// error.
+func (d *Decoder) MultiDocument(multi bool) {
+	d.multiDocument = multi
+}
+
+// startDocument is called when a root element is about to be dispatched.
+func (d *Decoder) startDocument() {
+	if d.multiDocument {
+		d.topHandler.text = d.topHandler.text[:0]
+	}
+
+	if d.documentStart != nil {
+		d.documentStart()
+	}
+}
+
+// endDocument is called when a root element has been closed.
+func (d *Decoder) endDocument() {
+	if d.documentEnd != nil {
+		d.documentEnd()
+	}
+
+	if d.multiDocument && d.snapshot != nil {
+		d.topHandler = d.snapshot.clone()
+		d.currentHandler = d.topHandler
+	}
+}
+
+// clone returns a deep copy of a handler tree, without pending text.
+func (h *handler) clone() *handler {
+	c := &handler{
+		tagCallback:   h.tagCallback,
+		tagCallbackE:  h.tagCallbackE,
+		textCallback:  h.textCallback,
+		textCallbackE: h.textCallbackE,
+		parallel:      h.parallel,
+	}
+
+	if h.subHandlers != nil {
+		c.subHandlers = make(map[string]*handler, len(h.subHandlers))
+		for name, sub := range h.subHandlers {
+			c.subHandlers[name] = sub.clone()
+		}
+	}
+
+	return c
+}
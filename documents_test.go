@@ -0,0 +1,109 @@
+package exml
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const DOCUMENTS = `<?xml version="1.0"?>
+<message kind="chat"><body>Hello</body><thread>t1</thread></message>
+stray text
+<?xml version="1.0"?>
+<message kind="presence"><body>Away</body><thread>t2</thread></message>
+<message kind="chat"><body>Bye</body><thread>t3</thread></message>`
+
+func (s *EXMLSuite) Test_MultiDocument(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(DOCUMENTS))
+	decoder.MultiDocument(true)
+
+	starts := 0
+	ends := 0
+	decoder.OnDocumentStart(func() {
+		starts = starts + 1
+	})
+	decoder.OnDocumentEnd(func() {
+		ends = ends + 1
+	})
+
+	texts := []string{}
+	bodies := []string{}
+	threads := []string{}
+	decoder.OnText(Append(&texts))
+	decoder.On("message", func(attrs Attrs) {
+		decoder.OnTextOf("body", Append(&bodies))
+		if attrs.GetString("kind", "") == "chat" {
+			decoder.OnTextOf("thread", Append(&threads))
+		}
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(starts, check.Equals, 3)
+	c.Assert(ends, check.Equals, 3)
+	c.Assert(bodies, check.DeepEquals, []string{"Hello", "Away", "Bye"})
+	c.Assert(threads, check.DeepEquals, []string{"t1", "t3"})
+	c.Assert(texts, check.HasLen, 0)
+}
+
+func (s *EXMLSuite) Test_SingleDocumentMode(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(DOCUMENTS))
+
+	starts := 0
+	decoder.OnDocumentStart(func() {
+		starts = starts + 1
+	})
+
+	texts := []string{}
+	threads := []string{}
+	decoder.OnText(Append(&texts))
+	decoder.On("message", func(attrs Attrs) {
+		if attrs.GetString("kind", "") == "chat" {
+			decoder.OnTextOf("thread", Append(&threads))
+		}
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(starts, check.Equals, 3)
+	c.Assert(threads, check.DeepEquals, []string{"t1", "t2", "t3"})
+	c.Assert(texts, check.DeepEquals, []string{"stray text"})
+}
+
+func (s *EXMLSuite) Test_MultiDocumentEncodings(c *check.C) {
+	doc := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<message><body>caf\xe9</body></message>\n" +
+		"<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<message><body>cr\xe8me</body></message>")
+
+	for _, decoder := range []*Decoder{NewDecoder(bytes.NewReader(doc)), NewFastDecoder(bytes.NewReader(doc))} {
+		bodies := []string{}
+		decoder.MultiDocument(true)
+		decoder.OnTextOf("message/body", Append(&bodies))
+
+		c.Assert(decoder.Run(), check.IsNil)
+		c.Assert(bodies, check.DeepEquals, []string{"café", "crème"})
+	}
+	mixed := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<message><body>caf\xe9</body></message>\n" +
+		"<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<message><body>café</body></message>")
+	for _, decoder := range []*Decoder{NewDecoder(bytes.NewReader(mixed)), NewFastDecoder(bytes.NewReader(mixed))} {
+		bodies := []string{}
+		decoder.MultiDocument(true)
+		decoder.OnTextOf("message/body", Append(&bodies))
+
+		err := decoder.Run()
+		c.Assert(err, check.ErrorMatches, `exml: document declares encoding "UTF-8" after a document in ISO-8859-1`)
+		c.Assert(bodies, check.DeepEquals, []string{"café"})
+	}
+
+	// The input is converted from the first declaration of another
+	// encoding than UTF-8 on.
+	late := []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<message><body>café</body></message>\n" +
+		"<?xml version=\"1.0\" encoding=\"latin1\"?>\n<message><body>cr\xe8me</body></message>\n" +
+		"<message><body>caf\xe9</body></message>")
+	for _, decoder := range []*Decoder{NewDecoder(bytes.NewReader(late)), NewFastDecoder(bytes.NewReader(late))} {
+		bodies := []string{}
+		decoder.MultiDocument(true)
+		decoder.OnTextOf("message/body", Append(&bodies))
+
+		c.Assert(decoder.Run(), check.IsNil)
+		c.Assert(bodies, check.DeepEquals, []string{"café", "crème", "café"})
+	}
+}
@@ -0,0 +1,57 @@
+package exml
+
+import "fmt"
+
+// ErrorPolicy defines how a Decoder reacts to errors returned by callbacks.
+type ErrorPolicy int
+
+const (
+	// StopOnError reports the error and stops the parsing process, the
+	// error being returned by Run.
+	StopOnError ErrorPolicy = iota
+
+	// ContinueOnError reports the error and carries on with the parsing.
+	ContinueOnError
+
+	// SkipOnError reports the error and carries on with the parsing after
+	// the end of the element being parsed when the error occurred, its
+	// remaining content being ignored.
+	SkipOnError
+)
+
+// A CallbackError wraps an error returned by a callback with the path of
+// the element being parsed and the position of the token which triggered
+// the callback.
+type CallbackError struct {
+	Path   string
+	Line   int
+	Column int
+	Offset int64
+	Err    error
+}
+
+func (e *CallbackError) Error() string {
+	return fmt.Sprintf("exml: line %d, column %d: %s: %v", e.Line, e.Column, e.Path, e.Err)
+}
+
+func (e *CallbackError) Unwrap() error {
+	return e.Err
+}
+
+// A PanicError is the error a recovered callback panic is converted to when
+// panic recovery is enabled with Decoder.RecoverPanics. It is wrapped in a
+// *CallbackError like any other callback error.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it is an error, nil otherwise.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
@@ -11,44 +11,127 @@ package exml
 import (
 	"bytes"
 	"encoding/xml"
+	"errors"
 	"io"
+	"iter"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"unsafe"
 )
 
 type TagCallback func(Attrs)
 type TextCallback func(CharData)
 type ErrorCallback func(error)
 
+// TagCallbackE and TextCallbackE are the error returning variants of
+// TagCallback and TextCallback. A non-nil error is wrapped in a
+// *CallbackError and handled according to the decoder error policy.
+type TagCallbackE func(Attrs) error
+type TextCallbackE func(CharData) error
+
 type handler struct {
 	tagCallback   TagCallback
+	tagCallbackE  TagCallbackE
 	textCallback  TextCallback
+	textCallbackE TextCallbackE
 	subHandlers   map[string]*handler
-	parentHandler *handler
+	parallel      *parallel
 	text          []byte
+	inert         bool
+}
+
+// A frame records an open element along with the handler which is
+// current while its content is being parsed.
+type frame struct {
+	name    xml.Name
+	attr    []xml.Attr
+	handler *handler
 }
 
 // A Decoder wraps an xml.Decoder and maintains the various states
 // between the encountered XML nodes during parsing.
 type Decoder struct {
 	decoder        *xml.Decoder
+	source         xml.TokenReader
+	input          *inputReader
+	stream         *streamReader
+	record         []string
 	topHandler     *handler
 	currentHandler *handler
+	stack          []frame
 	errorCallback  ErrorCallback
+	errorPolicy    ErrorPolicy
+	recoverPanics  bool
+	skip           int
+	stripNSDecls   bool
+	html           bool
+	multiDocument  bool
+	snapshot       *handler
+	documentStart  func()
+	documentEnd    func()
+	limits         Limits
+	tokens         int64
+	element        xml.Name
+	opened         bool
+	resume         []xml.StartElement
+	capture        *record
+	free           []*handler
+	filter         *filter
+	parallels      []*parallel
+	recorder       *recordingSource
+	started        bool
+	conversion     *conversion
+	line           int
+	column         int
+	offset         int64
+	base           int64
+	lineBase       int
+	columnBase     int
 }
 
-// NewDecoder creates a new exml parser reading from r.
+// NewDecoder creates a new exml parser reading from r. Besides UTF-8, the
+// parser handles UTF-16 inputs as well as the single byte encodings
+// supported by CharsetReader.
 func NewDecoder(r io.Reader) *Decoder {
-	return NewCustomDecoder(xml.NewDecoder(r))
+	input := &inputReader{r: r}
+	stream := newStreamReader(NewUTF8Reader(input))
+	xd := xml.NewDecoder(stream)
+	conv := &conversion{}
+	xd.CharsetReader = conv.reader
+	d := NewCustomDecoder(xd)
+	d.conversion = conv
+	d.input = input
+	d.stream = stream
+	return d
+}
+
+// NewTokenDecoder creates a new exml parser dispatching the tokens read
+// from the passed token reader, which may be a token filter, a recording
+// being replayed or another tokenizer. Start elements are expected to be
+// balanced by end elements, and their attributes must not be modified by
+// the reader once returned. Reported positions are only available when the
+// reader has InputPos and InputOffset methods like an xml.Decoder, and are
+// zero otherwise. Recovering from malformed input is not available.
+func NewTokenDecoder(tr xml.TokenReader) *Decoder {
+	if xd, ok := tr.(*xml.Decoder); ok {
+		return NewCustomDecoder(xd)
+	}
+
+	d := NewCustomDecoder(nil)
+	d.source = tr
+	return d
 }
 
 // NewCustomDecoder creates a new exml parser reading from the passed
 // xml.Decoder which is useful when you need to configure the underlying
-// decoder, when you need to handle non-UTF8 xml documents for example.
+// decoder, when you need to handle encodings which are not supported by
+// CharsetReader for example.
 func NewCustomDecoder(d *xml.Decoder) *Decoder {
 	topHandler := &handler{}
 	return &Decoder{
 		decoder:        d,
+		source:         d,
 		topHandler:     topHandler,
 		currentHandler: topHandler,
 	}
@@ -60,6 +143,12 @@ func (d *Decoder) On(path string, callback TagCallback) {
 	h.tagCallback = callback
 }
 
+// OnE registers an error returning handler for a single tag or for a path.
+func (d *Decoder) OnE(path string, callback TagCallbackE) {
+	h := d.installHandlers(path)
+	h.tagCallbackE = callback
+}
+
 // OnTextOf registers a handler for the text content of a single tag or
 // for the text content at a certain path.
 func (d *Decoder) OnTextOf(path string, callback TextCallback) {
@@ -67,96 +156,521 @@ func (d *Decoder) OnTextOf(path string, callback TextCallback) {
 	h.textCallback = callback
 }
 
+// OnTextOfE registers an error returning handler for the text content of
+// a single tag or for the text content at a certain path.
+func (d *Decoder) OnTextOfE(path string, callback TextCallbackE) {
+	h := d.installHandlers(path)
+	h.textCallbackE = callback
+}
+
 // OnText registers a handler for the text content of the current tag.
 func (d *Decoder) OnText(callback TextCallback) {
 	d.currentHandler.textCallback = callback
+	d.currentHandler.textCallbackE = nil
+}
+
+// OnTextE registers an error returning handler for the text content of
+// the current tag.
+func (d *Decoder) OnTextE(callback TextCallbackE) {
+	d.currentHandler.textCallbackE = callback
+	d.currentHandler.textCallback = nil
 }
 
 func (d *Decoder) installHandlers(path string) *handler {
-	events := strings.Split(path, "/")
-	depth := len(events) - 1
+	if d.html {
+		path = strings.ToLower(path)
+	}
+
 	h := d.currentHandler
+	for {
+		event, rest, nested := strings.Cut(path, "/")
+		if h.subHandlers == nil {
+			h.subHandlers = make(map[string]*handler)
+		}
 
-	var sub *handler
-	for i, ev := range events {
-		if i < depth {
-			sub = h.subHandlers[ev]
-			if sub == nil {
-				sub = &handler{parentHandler: h}
+		sub := h.subHandlers[event]
+		if !nested {
+			// The handler is replaced, which allows to reuse it when none
+			// of the open elements uses it.
+			if sub == nil || d.isOpen(sub) {
+				sub = &handler{}
+				h.subHandlers[event] = sub
+			} else {
+				sub.reset()
 			}
-		} else {
-			sub = &handler{parentHandler: h}
+
+			return sub
 		}
 
-		if h.subHandlers == nil {
-			h.subHandlers = make(map[string]*handler)
+		if sub == nil {
+			sub = &handler{}
+			h.subHandlers[event] = sub
 		}
 
-		h.subHandlers[ev] = sub
 		h = sub
+		path = rest
+	}
+}
+
+// isOpen returns true when one of the open elements uses the passed
+// handler.
+func (d *Decoder) isOpen(h *handler) bool {
+	for _, f := range d.stack {
+		if f.handler == h {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reset clears the callbacks and the sub-handlers of a handler, keeping
+// its sub-handlers map and text buffer.
+func (h *handler) reset() {
+	h.tagCallback = nil
+	h.tagCallbackE = nil
+	h.textCallback = nil
+	h.textCallbackE = nil
+	h.parallel = nil
+	clear(h.subHandlers)
+	h.text = h.text[:0]
+}
+
+// inertHandler returns a handler without callbacks for an element which
+// matches no handler, taken from the free list when possible.
+func (d *Decoder) inertHandler() *handler {
+	if n := len(d.free); n > 0 {
+		h := d.free[n-1]
+		d.free = d.free[:n-1]
+		return h
 	}
 
-	return sub
+	return &handler{inert: true}
+}
+
+// release puts back the handler of a closed element in the free list when
+// it is an inert handler no other open element uses.
+func (d *Decoder) release(h *handler) {
+	if !h.inert || h == d.currentHandler {
+		return
+	}
+
+	h.reset()
+	d.free = append(d.free, h)
 }
 
 // OnError registers a global error handler which will be called whenever
-// the underlying xml.Decoder reports an error.
+// the underlying xml.Decoder reports an error or a callback fails.
 func (d *Decoder) OnError(handler ErrorCallback) {
 	d.errorCallback = handler
 }
 
-// Run starts the parsing process.
-func (d *Decoder) Run() {
+// SetErrorPolicy defines how errors returned by callbacks are handled,
+// the default policy being StopOnError.
+func (d *Decoder) SetErrorPolicy(policy ErrorPolicy) {
+	d.errorPolicy = policy
+}
+
+// RecoverPanics controls whether panics raised by callbacks are recovered,
+// in which case they are converted to *PanicError values and handled like
+// errors returned by callbacks, according to the error policy. Panics are
+// not recovered by default.
+func (d *Decoder) RecoverPanics(recover bool) {
+	d.recoverPanics = recover
+}
+
+// StripNamespaceDecls controls whether namespace declarations (xmlns and
+// xmlns:* attributes) are removed from the attributes passed to tag
+// callbacks. They are kept by default.
+func (d *Decoder) StripNamespaceDecls(strip bool) {
+	d.stripNSDecls = strip
+}
+
+// Run starts the parsing process. It returns the error which stopped it,
+// either reported by the underlying xml.Decoder or returned by a callback,
+// or nil when the whole input was consumed. The error is also passed to
+// the error handler when one is registered.
+func (d *Decoder) Run() error {
 	for {
-		token, err := d.decoder.Token()
-		if token == nil {
-			if err != io.EOF && d.errorCallback != nil {
-				d.errorCallback(err)
-			}
-			break
+		if _, done, err := d.step(); done {
+			return err
 		}
+	}
+}
+
+// step reads and dispatches a single token, starting a parsing pass first
+// when needed. It returns true once parsing is over, along with the error
+// which stopped it, and otherwise the token which was read when the decoder
+// records them, for the functions driving a decoder which handle every
+// token after its dispatch.
+func (d *Decoder) step() (xml.Token, bool, error) {
+	if !d.started {
+		d.started = true
+		d.start()
+		if err := d.replay(); err != nil {
+			d.started = false
+			return nil, true, d.wait(err)
+		}
+	}
+
+	if d.recorder != nil {
+		d.recorder.current = nil
+	}
+
+	done, err := d.next()
+	if done {
+		d.started = false
+		return nil, true, d.wait(err)
+	}
 
-		switch t := token.(type) {
-		case xml.StartElement:
-			d.handleText()
-			d.handleTag(t)
-		case xml.CharData:
+	if d.recorder != nil {
+		return d.recorder.current, false, nil
+	}
+	return nil, false, nil
+}
+
+// recordTokens makes the decoder record the tokens read from its source,
+// which are then returned by step. The passed function, which may be nil,
+// is called with every token as soon as it is read.
+func (d *Decoder) recordTokens(read func(xml.Token)) {
+	d.recorder = &recordingSource{tr: d.source, read: read}
+	d.source = d.recorder
+}
+
+// A recordingSource records the last token read by a decoder.
+type recordingSource struct {
+	tr      xml.TokenReader
+	current xml.Token
+	read    func(xml.Token)
+}
+
+func (s *recordingSource) Token() (xml.Token, error) {
+	t, err := s.tr.Token()
+	s.current = t
+	if s.read != nil && err == nil {
+		s.read(t)
+	}
+	return t, err
+}
+
+func (s *recordingSource) InputPos() (int, int) {
+	if p, ok := s.tr.(positioner); ok {
+		return p.InputPos()
+	}
+	return 0, 0
+}
+
+func (s *recordingSource) InputOffset() int64 {
+	if p, ok := s.tr.(positioner); ok {
+		return p.InputOffset()
+	}
+	return 0
+}
+
+// start prepares the decoder for a parsing pass.
+func (d *Decoder) start() {
+	d.tokens = 0
+	if d.multiDocument {
+		d.snapshot = d.topHandler.clone()
+	}
+}
+
+// next reads and dispatches a single token. It returns true when parsing
+// is over, along with the error which stopped it if any.
+func (d *Decoder) next() (bool, error) {
+	d.line, d.column, d.offset = d.position()
+	d.opened = false
+	token, err := d.source.Token()
+	if token == nil {
+		switch {
+		case err == io.EOF:
+			return true, d.closeAll()
+		case err == errNeedMore:
+			return true, err
+		case errors.Is(err, errInputLimit):
+			err = d.limitError("MaxInputBytes", d.limits.MaxInputBytes)
+		case d.canResync(err):
+			err = d.resync(err)
+			return err != nil, err
+		}
+		return true, d.fail(err)
+	}
+
+	if err = d.checkToken(); err != nil {
+		return true, d.fail(err)
+	}
+
+	if d.capture != nil {
+		if captured, err := d.captureToken(token); captured || err != nil {
+			return err != nil, err
+		}
+	}
+
+	switch t := token.(type) {
+	case xml.StartElement:
+		err = d.startElement(t)
+	case xml.CharData:
+		if d.skip == 0 {
+			if err = d.checkText(len(d.currentHandler.text) + len(t)); err != nil {
+				return true, d.fail(err)
+			}
 			d.currentHandler.text = append(d.currentHandler.text, t...)
-		case xml.EndElement:
-			d.handleText()
-			if d.currentHandler != d.topHandler {
-				d.currentHandler = d.currentHandler.parentHandler
+		}
+	case xml.EndElement:
+		err = d.endElement(t.Name)
+	case xml.ProcInst:
+		if t.Target == "xml" && d.conversion != nil {
+			if err = d.conversion.declare(declValue(string(t.Inst), "encoding")); err != nil {
+				return true, d.fail(err)
 			}
 		}
 	}
+
+	return err != nil, err
 }
 
-func (d *Decoder) handleTag(t xml.StartElement) {
+// startElement dispatches a start element, or only records it when the
+// enclosing element is being skipped after a callback failure. The returned
+// error means that parsing must stop.
+func (d *Decoder) startElement(t xml.StartElement) error {
+	if d.html {
+		foldCase(&t)
+		if err := d.closeImplied(t.Name.Local); err != nil {
+			return err
+		}
+	}
+
+	if len(d.stack) == 0 {
+		d.startDocument()
+	}
+
+	if d.skip == 0 {
+		if err := d.callbackError(d.handleText()); err != nil {
+			return err
+		}
+	}
+
+	if err := d.checkElement(len(d.stack), t.Attr); err != nil {
+		return d.fail(err)
+	}
+
+	if d.skip > 0 {
+		d.stack = append(d.stack, frame{name: t.Name, attr: t.Attr, handler: d.currentHandler})
+		d.opened = true
+	} else if err := d.callbackError(d.handleTag(t)); err != nil {
+		return err
+	}
+
+	if d.html && isVoidElement(t.Name.Local) {
+		return d.popElement()
+	}
+
+	return nil
+}
+
+// endElement closes the current element. In HTML mode, the end tag closes
+// the matching open element along with the unclosed elements it contains
+// and stray end tags are ignored.
+func (d *Decoder) endElement(name xml.Name) error {
+	if d.html {
+		i := d.findOpen(strings.ToLower(name.Local))
+		if i < 0 {
+			return nil
+		}
+
+		return d.popElements(i)
+	}
+
+	return d.popElement()
+}
+
+// closeAll closes the elements left open at the end of the input, which
+// only happens in HTML mode since the xml.Decoder rejects such inputs
+// otherwise.
+func (d *Decoder) closeAll() error {
+	return d.popElements(0)
+}
+
+// popElements closes the open elements down to the one at index i of the
+// stack included.
+func (d *Decoder) popElements(i int) error {
+	for len(d.stack) > i {
+		if err := d.popElement(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// popElement dispatches the pending text content of the current element and
+// closes it. The returned error means that parsing must stop.
+func (d *Decoder) popElement() error {
+	if d.skip == 0 {
+		if err := d.callbackError(d.handleText()); err != nil {
+			return err
+		}
+	} else {
+		d.currentHandler.text = d.currentHandler.text[:0]
+	}
+
+	if len(d.stack) == 0 {
+		return nil
+	}
+
+	closed := d.stack[len(d.stack)-1].handler
+	d.stack = d.stack[:len(d.stack)-1]
+	if len(d.stack) == 0 {
+		d.currentHandler = d.topHandler
+	} else {
+		d.currentHandler = d.stack[len(d.stack)-1].handler
+	}
+	d.release(closed)
+
+	// The skipped element is over.
+	if len(d.stack) < d.skip {
+		d.skip = 0
+	}
+
+	if len(d.stack) == 0 {
+		d.endDocument()
+	}
+
+	return nil
+}
+
+func (d *Decoder) handleTag(t xml.StartElement) (err error) {
 	h := d.topHandler.subHandlers[t.Name.Local]
-	if h == nil && d.currentHandler != d.topHandler {
-		h = d.currentHandler.subHandlers[t.Name.Local]
-		if h == nil {
-			h = &handler{}
+	if h == nil {
+		h = d.currentHandler
+		if h != d.topHandler {
+			h = h.subHandlers[t.Name.Local]
+			if h == nil {
+				h = d.inertHandler()
+			}
 		}
 	}
 
-	if h != nil {
-		h.parentHandler = d.currentHandler
-		d.currentHandler = h
-		if h.tagCallback != nil {
-			h.tagCallback(t.Attr)
+	d.element = t.Name
+	d.stack = append(d.stack, frame{name: t.Name, attr: t.Attr, handler: h})
+	d.currentHandler = h
+	d.opened = true
+
+	if h.parallel != nil {
+		d.startRecord(h.parallel, t)
+		return nil
+	}
+
+	if h.tagCallback == nil && h.tagCallbackE == nil {
+		return nil
+	}
+
+	if d.recoverPanics {
+		defer recoverPanic(&err)
+	}
+
+	if d.filter != nil {
+		d.filter.target = targetTag
+		defer d.filter.untarget()
+	}
+
+	attrs := Attrs(t.Attr)
+	if d.stripNSDecls {
+		attrs = attrs.WithoutNamespaceDecls()
+	}
+
+	if h.tagCallback != nil {
+		h.tagCallback(attrs)
+		return nil
+	}
+
+	return h.tagCallbackE(attrs)
+}
+
+func (d *Decoder) handleText() (err error) {
+	h := d.currentHandler
+	text := bytes.TrimSpace(h.text)
+	h.text = h.text[:0]
+	if len(text) == 0 {
+		return nil
+	}
+
+	if d.recoverPanics {
+		defer recoverPanic(&err)
+	}
+
+	if d.filter != nil {
+		d.filter.target = targetText
+		defer d.filter.untarget()
+	}
+
+	if h.textCallback != nil {
+		h.textCallback(text)
+	} else if h.textCallbackE != nil {
+		return h.textCallbackE(text)
+	}
+
+	return nil
+}
+
+// path returns the slash separated local names of the open elements.
+func (d *Decoder) path() string {
+	var b strings.Builder
+	for i, f := range d.stack {
+		if i > 0 {
+			b.WriteByte('/')
 		}
+		b.WriteString(f.name.Local)
+	}
+
+	return b.String()
+}
+
+// callbackError wraps a non-nil error returned by a callback and handles it
+// according to the error policy, returning it if parsing must stop.
+func (d *Decoder) callbackError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	err = &CallbackError{
+		Path:   d.path(),
+		Line:   d.line,
+		Column: d.column,
+		Offset: d.offset,
+		Err:    err,
+	}
+
+	switch d.errorPolicy {
+	case ContinueOnError:
+		d.report(err)
+		return nil
+	case SkipOnError:
+		d.report(err)
+		d.skip = len(d.stack)
+		return nil
+	}
+
+	return d.fail(err)
+}
+
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
 	}
 }
 
-func (d *Decoder) handleText() {
-	text := bytes.TrimSpace(d.currentHandler.text)
-	d.currentHandler.text = d.currentHandler.text[:0]
-	if d.currentHandler.textCallback != nil && len(text) > 0 {
-		d.currentHandler.textCallback(text)
+func (d *Decoder) report(err error) {
+	if d.errorCallback != nil {
+		d.errorCallback(err)
 	}
 }
 
+func (d *Decoder) fail(err error) error {
+	d.report(err)
+	return err
+}
+
 // Assign is a helper function which returns a text callback that assigns
 // the text content of the current tag to the passed variable pointer.
 func Assign(v *string) TextCallback {
@@ -172,12 +686,7 @@ func Assign(v *string) TextCallback {
 // value is used when the parsing of the text content fails.
 func AssignBool(v *bool, fallback bool) TextCallback {
 	return func(c CharData) {
-		val, err := strconv.ParseBool(string(c))
-		if err == nil {
-			*v = val
-		} else {
-			*v = fallback
-		}
+		*v = parseBool(c, fallback)
 	}
 }
 
@@ -188,12 +697,7 @@ func AssignBool(v *bool, fallback bool) TextCallback {
 // value is used when the parsing of the text content fails.
 func AssignFloat(v *float64, bitsize int, fallback float64) TextCallback {
 	return func(c CharData) {
-		val, err := strconv.ParseFloat(string(c), bitsize)
-		if err == nil {
-			*v = val
-		} else {
-			*v = fallback
-		}
+		*v = parseFloat(c, bitsize, fallback)
 	}
 }
 
@@ -204,12 +708,7 @@ func AssignFloat(v *float64, bitsize int, fallback float64) TextCallback {
 // value is used when the parsing of the text content fails.
 func AssignInt(v *int64, base int, bitsize int, fallback int64) TextCallback {
 	return func(c CharData) {
-		val, err := strconv.ParseInt(string(c), base, bitsize)
-		if err == nil {
-			*v = val
-		} else {
-			*v = fallback
-		}
+		*v = parseInt(c, base, bitsize, fallback)
 	}
 }
 
@@ -220,12 +719,7 @@ func AssignInt(v *int64, base int, bitsize int, fallback int64) TextCallback {
 // value is used when the parsing of the text content fails.
 func AssignUInt(v *uint64, base int, bitsize int, fallback uint64) TextCallback {
 	return func(c CharData) {
-		val, err := strconv.ParseUint(string(c), base, bitsize)
-		if err == nil {
-			*v = val
-		} else {
-			*v = fallback
-		}
+		*v = parseUInt(c, base, bitsize, fallback)
 	}
 }
 
@@ -244,9 +738,7 @@ func Append(a *[]string) TextCallback {
 // the parsing of the text content fails.
 func AppendBool(a *[]bool, fallback bool) TextCallback {
 	return func(c CharData) {
-		var val bool
-		AssignBool(&val, fallback)(c)
-		*a = append(*a, val)
+		*a = append(*a, parseBool(c, fallback))
 	}
 }
 
@@ -257,9 +749,7 @@ func AppendBool(a *[]bool, fallback bool) TextCallback {
 // the parsing of the text content fails.
 func AppendFloat(a *[]float64, bitsize int, fallback float64) TextCallback {
 	return func(c CharData) {
-		var val float64
-		AssignFloat(&val, bitsize, fallback)(c)
-		*a = append(*a, val)
+		*a = append(*a, parseFloat(c, bitsize, fallback))
 	}
 }
 
@@ -270,9 +760,7 @@ func AppendFloat(a *[]float64, bitsize int, fallback float64) TextCallback {
 // the parsing of the text content fails.
 func AppendInt(a *[]int64, base int, bitsize int, fallback int64) TextCallback {
 	return func(c CharData) {
-		var val int64
-		AssignInt(&val, base, bitsize, fallback)(c)
-		*a = append(*a, val)
+		*a = append(*a, parseInt(c, base, bitsize, fallback))
 	}
 }
 
@@ -283,10 +771,43 @@ func AppendInt(a *[]int64, base int, bitsize int, fallback int64) TextCallback {
 // the parsing of the text content fails.
 func AppendUInt(a *[]uint64, base int, bitsize int, fallback uint64) TextCallback {
 	return func(c CharData) {
-		var val uint64
-		AssignUInt(&val, base, bitsize, fallback)(c)
-		*a = append(*a, val)
+		*a = append(*a, parseUInt(c, base, bitsize, fallback))
+	}
+}
+
+// view returns the text content as a string sharing its memory, which is
+// only valid during the callback and must not be retained. The strconv
+// parsing functions copy the strings they keep in their errors.
+func view(c CharData) string {
+	return unsafe.String(unsafe.SliceData(c), len(c))
+}
+
+func parseBool(c CharData, fallback bool) bool {
+	if val, err := strconv.ParseBool(view(c)); err == nil {
+		return val
 	}
+	return fallback
+}
+
+func parseFloat(c CharData, bitsize int, fallback float64) float64 {
+	if val, err := strconv.ParseFloat(view(c), bitsize); err == nil {
+		return val
+	}
+	return fallback
+}
+
+func parseInt(c CharData, base int, bitsize int, fallback int64) int64 {
+	if val, err := strconv.ParseInt(view(c), base, bitsize); err == nil {
+		return val
+	}
+	return fallback
+}
+
+func parseUInt(c CharData, base int, bitsize int, fallback uint64) uint64 {
+	if val, err := strconv.ParseUint(view(c), base, bitsize); err == nil {
+		return val
+	}
+	return fallback
 }
 
 type CharData xml.CharData
@@ -304,6 +825,100 @@ func (a Attrs) Get(name string) (string, bool) {
 	return "", false
 }
 
+// GetNS returns the value of the requested attribute in the given namespace
+// and true when the attribute exists, or an empty string and false when it
+// doesn't. The space parameter is the namespace URL the attribute prefix is
+// bound to, or an empty string for unqualified attributes.
+func (a Attrs) GetNS(space, local string) (string, bool) {
+	for _, attr := range a {
+		if attr.Name.Space == space && attr.Name.Local == local {
+			return attr.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Has returns true when the requested attribute exists.
+func (a Attrs) Has(name string) bool {
+	_, ok := a.Get(name)
+	return ok
+}
+
+// Names returns the names of the attributes in document order.
+func (a Attrs) Names() []xml.Name {
+	names := make([]xml.Name, len(a))
+	for i, attr := range a {
+		names[i] = attr.Name
+	}
+
+	return names
+}
+
+// All returns an iterator over the names and values of the attributes in
+// document order.
+func (a Attrs) All() iter.Seq2[xml.Name, string] {
+	return func(yield func(xml.Name, string) bool) {
+		for _, attr := range a {
+			if !yield(attr.Name, attr.Value) {
+				return
+			}
+		}
+	}
+}
+
+// ToMap returns the attributes as a map of values indexed by their fully
+// qualified names.
+func (a Attrs) ToMap() map[xml.Name]string {
+	m := make(map[xml.Name]string, len(a))
+	for _, attr := range a {
+		m[attr.Name] = attr.Value
+	}
+
+	return m
+}
+
+// WithoutNamespaceDecls returns the attributes minus the namespace
+// declarations. The receiver is returned as is when it doesn't contain
+// any declaration.
+func (a Attrs) WithoutNamespaceDecls() Attrs {
+	n := 0
+	for _, attr := range a {
+		if isNamespaceDecl(attr) {
+			n++
+		}
+	}
+
+	if n == 0 {
+		return a
+	}
+
+	filtered := make(Attrs, 0, len(a)-n)
+	for _, attr := range a {
+		if !isNamespaceDecl(attr) {
+			filtered = append(filtered, attr)
+		}
+	}
+
+	return filtered
+}
+
+// NamespaceDecls returns the namespace declarations among the attributes.
+func (a Attrs) NamespaceDecls() Attrs {
+	var decls Attrs
+	for _, attr := range a {
+		if isNamespaceDecl(attr) {
+			decls = append(decls, attr)
+		}
+	}
+
+	return decls
+}
+
+func isNamespaceDecl(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns")
+}
+
 // GetString returns the value of the requested attribute when it exists
 // or the passed fallback value when it doesn't.
 func (a Attrs) GetString(name string, fallback string) string {
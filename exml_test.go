@@ -1,8 +1,11 @@
 package exml
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 
@@ -143,6 +146,73 @@ func (s *EXMLSuite) Test_AttributeReaders(c *check.C) {
 	c.Assert(handlerWasCalled, check.Equals, true)
 }
 
+const NAMESPACED = `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+    <a href="plain" xlink:href="linked" />
+</svg>`
+
+func (s *EXMLSuite) Test_NamespacedAttributes(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(NAMESPACED))
+	handlerWasCalled := false
+
+	decoder.On("svg/a", func(attrs Attrs) {
+		handlerWasCalled = true
+
+		val, ok := attrs.GetNS("http://www.w3.org/1999/xlink", "href")
+		c.Assert(val, check.Equals, "linked")
+		c.Assert(ok, check.Equals, true)
+
+		val, ok = attrs.GetNS("", "href")
+		c.Assert(val, check.Equals, "plain")
+		c.Assert(ok, check.Equals, true)
+
+		_, ok = attrs.GetNS("http://www.w3.org/2000/svg", "href")
+		c.Assert(ok, check.Equals, false)
+
+		c.Assert(attrs.Has("href"), check.Equals, true)
+		c.Assert(attrs.Has("src"), check.Equals, false)
+
+		names := attrs.Names()
+		c.Assert(names, check.HasLen, 2)
+		c.Assert(names[0], check.Equals, xml.Name{Local: "href"})
+		c.Assert(names[1], check.Equals, xml.Name{Space: "http://www.w3.org/1999/xlink", Local: "href"})
+
+		values := []string{}
+		for _, v := range attrs.All() {
+			values = append(values, v)
+		}
+		c.Assert(values, check.DeepEquals, []string{"plain", "linked"})
+
+		m := attrs.ToMap()
+		c.Assert(m, check.HasLen, 2)
+		c.Assert(m[xml.Name{Space: "http://www.w3.org/1999/xlink", Local: "href"}], check.Equals, "linked")
+	})
+
+	decoder.Run()
+	c.Assert(handlerWasCalled, check.Equals, true)
+}
+
+func (s *EXMLSuite) Test_NamespaceDecls(c *check.C) {
+	var kept, stripped Attrs
+
+	decoder := NewDecoder(strings.NewReader(NAMESPACED))
+	decoder.On("svg", func(attrs Attrs) {
+		kept = attrs
+	})
+	decoder.Run()
+
+	decoder = NewDecoder(strings.NewReader(NAMESPACED))
+	decoder.StripNamespaceDecls(true)
+	decoder.On("svg", func(attrs Attrs) {
+		stripped = attrs
+	})
+	decoder.Run()
+
+	c.Assert(kept, check.HasLen, 2)
+	c.Assert(kept.WithoutNamespaceDecls(), check.HasLen, 0)
+	c.Assert(stripped, check.HasLen, 0)
+}
+
 const SIMPLE = `<?xml version="1.0"?>
 <root attr1="root.attr1" attr2="root.attr2">
     <node attr1="node1.attr1" attr2="node1.attr2" />
@@ -601,6 +671,250 @@ func (s *EXMLSuite) Test_EmptyInput(c *check.C) {
 	c.Assert(handlerWasCalled, check.Equals, false)
 }
 
+func (s *EXMLSuite) Test_RunError(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(MALFORMED))
+	err := decoder.Run()
+	c.Assert(err, check.FitsTypeOf, &xml.SyntaxError{})
+	c.Assert(NewDecoder(strings.NewReader(SIMPLE)).Run(), check.IsNil)
+}
+
+var errCallback = errors.New("callback error")
+
+func (s *EXMLSuite) Test_CallbackErrorStop(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(TEXT))
+
+	nodeNum := 0
+	reported := []error{}
+	decoder.OnError(func(err error) {
+		reported = append(reported, err)
+	})
+	decoder.OnTextOfE("root/node", func(text CharData) error {
+		nodeNum = nodeNum + 1
+		if nodeNum == 2 {
+			return errCallback
+		}
+		return nil
+	})
+
+	err := decoder.Run()
+
+	c.Assert(nodeNum, check.Equals, 2)
+	c.Assert(reported, check.HasLen, 1)
+	c.Assert(reported[0], check.Equals, err)
+	c.Assert(errors.Is(err, errCallback), check.Equals, true)
+
+	var cbErr *CallbackError
+	c.Assert(errors.As(err, &cbErr), check.Equals, true)
+	c.Assert(cbErr.Path, check.Equals, "root/node")
+	c.Assert(cbErr.Line, check.Equals, 4)
+	c.Assert(cbErr.Column, check.Equals, 25)
+	c.Assert(err.Error(), check.Equals, "exml: line 4, column 25: root/node: callback error")
+}
+
+func (s *EXMLSuite) Test_CallbackErrorContinue(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(SIMPLE))
+	decoder.SetErrorPolicy(ContinueOnError)
+
+	paths := []string{}
+	decoder.OnError(func(err error) {
+		paths = append(paths, err.(*CallbackError).Path)
+	})
+
+	nodeNum := 0
+	decoder.OnE("root/node", func(attrs Attrs) error {
+		nodeNum = nodeNum + 1
+		decoder.OnE("subnode", func(attrs Attrs) error {
+			return errCallback
+		})
+		return errCallback
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(nodeNum, check.Equals, 4)
+	c.Assert(paths, check.DeepEquals, []string{
+		"root/node", "root/node", "root/node", "root/node", "root/node/subnode",
+	})
+}
+
+func (s *EXMLSuite) Test_OnTextE(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(NESTED_TEXT))
+
+	texts := []string{}
+	decoder.OnTextE(func(text CharData) error {
+		texts = append(texts, string(text))
+		return nil
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(texts, check.DeepEquals, []string{"Root text 1", "Node text", "Root text 2"})
+}
+
+const PANIC = `<?xml version="1.0"?>
+<root>
+    <node id="1"><sub>text 1</sub></node>
+    <node id="2" panic="true"><sub>text 2</sub><sub>text 3</sub></node>
+    <node id="3"><sub>text 4</sub></node>
+</root>`
+
+func (s *EXMLSuite) Test_PanicNotRecovered(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(PANIC))
+	decoder.On("root/node", func(attrs Attrs) {
+		panic("boom")
+	})
+
+	c.Assert(func() { decoder.Run() }, check.PanicMatches, "boom")
+}
+
+func (s *EXMLSuite) Test_PanicRecoveredStop(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(PANIC))
+	decoder.RecoverPanics(true)
+
+	reported := 0
+	decoder.OnError(func(err error) {
+		reported = reported + 1
+	})
+
+	decoder.On("root/node", func(attrs Attrs) {
+		if attrs.GetBool("panic", false) {
+			panic(errCallback)
+		}
+	})
+
+	err := decoder.Run()
+	c.Assert(reported, check.Equals, 1)
+	c.Assert(errors.Is(err, errCallback), check.Equals, true)
+
+	var cbErr *CallbackError
+	c.Assert(errors.As(err, &cbErr), check.Equals, true)
+	c.Assert(cbErr.Path, check.Equals, "root/node")
+	c.Assert(cbErr.Line, check.Equals, 4)
+
+	var panicErr *PanicError
+	c.Assert(errors.As(err, &panicErr), check.Equals, true)
+	c.Assert(panicErr.Value, check.Equals, errCallback)
+	c.Assert(string(panicErr.Stack), check.Matches, "(?s).*Test_PanicRecoveredStop.*")
+}
+
+func (s *EXMLSuite) Test_PanicRecoveredSkip(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(PANIC))
+	decoder.RecoverPanics(true)
+	decoder.SetErrorPolicy(SkipOnError)
+
+	reported := []error{}
+	decoder.OnError(func(err error) {
+		reported = append(reported, err)
+	})
+
+	texts := []string{}
+	decoder.On("root/node", func(attrs Attrs) {
+		if attrs.GetBool("panic", false) {
+			panic("boom")
+		}
+		decoder.OnTextOf("sub", Append(&texts))
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(texts, check.DeepEquals, []string{"text 1", "text 4"})
+	c.Assert(reported, check.HasLen, 1)
+	c.Assert(reported[0], check.ErrorMatches, "exml: line 4, column 5: root/node: panic: boom")
+}
+
+func (s *EXMLSuite) Test_TextErrorSkip(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(NESTED_TEXT))
+	decoder.SetErrorPolicy(SkipOnError)
+
+	texts := []string{}
+	decoder.On("root", func(attrs Attrs) {
+		decoder.OnTextE(func(text CharData) error {
+			texts = append(texts, string(text))
+			return errCallback
+		})
+		decoder.OnTextOf("node", Append(&texts))
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(texts, check.DeepEquals, []string{"Root text 1"})
+}
+
+// A tokenSlice replays a list of tokens.
+type tokenSlice []xml.Token
+
+func (ts *tokenSlice) Token() (xml.Token, error) {
+	if len(*ts) == 0 {
+		return nil, io.EOF
+	}
+
+	t := (*ts)[0]
+	*ts = (*ts)[1:]
+	return t, nil
+}
+
+func (s *EXMLSuite) Test_TokenDecoder(c *check.C) {
+	el := func(name string, attrs ...string) xml.StartElement {
+		t := xml.StartElement{Name: xml.Name{Local: name}}
+		for i := 0; i < len(attrs); i += 2 {
+			t.Attr = append(t.Attr, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+		}
+		return t
+	}
+	end := func(name string) xml.EndElement {
+		return xml.EndElement{Name: xml.Name{Local: name}}
+	}
+
+	tokens := tokenSlice{
+		el("address-book", "name", "synthetic"),
+		xml.Comment("ignored"),
+		el("contact"), el("first-name"), xml.CharData("Ada"), end("first-name"), end("contact"),
+		el("contact"), el("first-name"), xml.CharData("Grace"), end("first-name"), end("contact"),
+		end("address-book"),
+	}
+
+	decoder := NewTokenDecoder(&tokens)
+	name := ""
+	names := []string{}
+	decoder.On("address-book", func(attrs Attrs) {
+		name, _ = attrs.Get("name")
+		decoder.OnTextOf("contact/first-name", Append(&names))
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(name, check.Equals, "synthetic")
+	c.Assert(names, check.DeepEquals, []string{"Ada", "Grace"})
+
+	var cbErr *CallbackError
+	tokens = tokenSlice{el("root"), el("last-name"), xml.CharData("Lovelace"), end("last-name"), end("root")}
+	decoder = NewTokenDecoder(&tokens)
+	decoder.OnError(func(err error) {
+		errors.As(err, &cbErr)
+	})
+	decoder.OnTextOfE("last-name", func(text CharData) error {
+		return errCallback
+	})
+	c.Assert(decoder.Run(), check.Equals, cbErr)
+	c.Assert(cbErr.Path, check.Equals, "root/last-name")
+	c.Assert(cbErr.Line, check.Equals, 0)
+	c.Assert(cbErr.Offset, check.Equals, int64(0))
+}
+
+func (s *EXMLSuite) Test_TokenDecoderPositions(c *check.C) {
+	// A wrapped xml.Decoder reports the positions of the tokens.
+	tr := struct{ *xml.Decoder }{xml.NewDecoder(strings.NewReader(EXAMPLE))}
+	decoder := NewTokenDecoder(tr)
+
+	var cbErr *CallbackError
+	decoder.OnTextOfE("address-book/contact/address", func(text CharData) error {
+		if string(text) == "Redmond" {
+			return errCallback
+		}
+		return nil
+	})
+
+	err := decoder.Run()
+	c.Assert(errors.As(err, &cbErr), check.Equals, true)
+	c.Assert(cbErr.Line, check.Equals, 12)
+	c.Assert(cbErr.Offset, check.Equals, int64(strings.Index(EXAMPLE, "</address>\n    </contact>\n    <contact>\n        <first-name>Mark")))
+}
+
 // ============================================================================
 // Benchmarks
 
@@ -706,3 +1020,94 @@ func runDecodeTextBenchmark(b *testing.B, data string) {
 		l.Texts = l.Texts[:0]
 	}
 }
+
+func largeCatalog(products int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?>` + "\n<catalog>\n")
+	for i := 0; i < products; i++ {
+		fmt.Fprintf(&b, `  <product id="%d" kind="book"><name>Product %d</name><price>%d.5</price>`, i, i, i%100)
+		b.WriteString(`<tags><tag>paper</tag><tag>new</tag></tags><misc><note>unmatched</note></misc></product>` + "\n")
+	}
+	b.WriteString("</catalog>\n")
+	return b.Bytes()
+}
+
+// decodeCatalog parses a catalog registering the product handlers from the
+// catalog callback and the nested ones from every product callback, the
+// callbacks being created once.
+func decodeCatalog(data []byte, newDecoder func(io.Reader) *Decoder) (int, error) {
+	decoder := newDecoder(bytes.NewReader(data))
+
+	count := 0
+	var price float64
+	var tags int64
+	onName := func(text CharData) {
+		count++
+	}
+	onPrice := AssignFloat(&price, 64, 0)
+	onTag := func(text CharData) {
+		tags += int64(len(text))
+	}
+	onProduct := func(attrs Attrs) {
+		decoder.OnTextOf("name", onName)
+		decoder.OnTextOf("price", onPrice)
+		decoder.OnTextOf("tags/tag", onTag)
+	}
+	decoder.On("catalog", func(attrs Attrs) {
+		decoder.On("product", onProduct)
+	})
+
+	err := decoder.Run()
+	return count, err
+}
+
+// tokenizeCatalog reads all the tokens of a catalog with a bare
+// xml.Decoder, which is the allocation baseline of decodeCatalog.
+func tokenizeCatalog(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (s *EXMLSuite) Test_DispatchAllocations(c *check.C) {
+	small := largeCatalog(10)
+	large := largeCatalog(1000)
+
+	count, err := decodeCatalog(large, NewDecoder)
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1000)
+
+	overhead := func(data []byte) float64 {
+		decode := testing.AllocsPerRun(5, func() { decodeCatalog(data, NewDecoder) })
+		tokenize := testing.AllocsPerRun(5, func() { tokenizeCatalog(data) })
+		return decode - tokenize
+	}
+
+	// The dispatch overhead does not depend on the number of elements.
+	c.Assert(overhead(large)-overhead(small) < 10, check.Equals, true,
+		check.Commentf("small: %v, large: %v", overhead(small), overhead(large)))
+}
+
+func Benchmark_TokenizeLarge(b *testing.B) {
+	data := largeCatalog(20000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tokenizeCatalog(data)
+	}
+}
+
+func Benchmark_DecodeLarge(b *testing.B) {
+	data := largeCatalog(20000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		decodeCatalog(data, NewDecoder)
+	}
+}
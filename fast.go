@@ -0,0 +1,718 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewFastDecoder creates a new exml parser reading from r with a built-in
+// tokenizer instead of an xml.Decoder, which is faster and allocates less.
+// It handles the subset of XML needed by exml: elements, attributes,
+// namespaces, text, CDATA sections and the predefined and numeric
+// entities. Comments, processing instructions and DOCTYPE declarations are
+// skipped, and the entities they declare are not expanded. The input is
+// decoded like NewDecoder does.
+//
+// Like with an xml.Decoder, malformed input is reported as an
+// *xml.SyntaxError, but the character ranges of names and text are not
+// checked. Recovering from malformed input is not available.
+func NewFastDecoder(r io.Reader) *Decoder {
+	return NewTokenDecoder(newScanner(NewUTF8Reader(r)))
+}
+
+const xmlURL = "http://www.w3.org/XML/1998/namespace"
+
+// A scanner is an xml.TokenReader tokenizing UTF-8 XML. CharData tokens
+// share the memory of the scanner and are only valid until the next call
+// to Token, like the ones of an xml.Decoder.
+type scanner struct {
+	r    io.Reader
+	buf  []byte
+	pos  int
+	err  error
+	done bool
+
+	// Positions: offset of buf[0], and line accounting up to counted.
+	offset    int64
+	line      int
+	lineStart int64
+	counted   int
+
+	text    []byte
+	scratch []byte
+	names   map[string]string
+	open    []string
+	ns      []binding
+	marks   []int
+	end     xml.EndElement
+	empty   bool
+
+	// conv tracks the encodings declared by the documents of the input.
+	conv conversion
+}
+
+// A binding maps a namespace prefix to a namespace URL, the default
+// namespace having an empty prefix.
+type binding struct {
+	prefix string
+	url    string
+}
+
+func newScanner(r io.Reader) *scanner {
+	return &scanner{
+		r:     r,
+		buf:   make([]byte, 0, 64*1024),
+		line:  1,
+		names: map[string]string{},
+	}
+}
+
+// fill makes more input available in the buffer, dropping the consumed
+// bytes. It returns false at the end of the input.
+func (s *scanner) fill() bool {
+	if s.done {
+		return false
+	}
+
+	s.countLines()
+	if s.pos > 0 {
+		n := copy(s.buf, s.buf[s.pos:])
+		s.buf = s.buf[:n]
+		s.offset += int64(s.pos)
+		s.counted -= s.pos
+		s.pos = 0
+	}
+
+	if len(s.buf) == cap(s.buf) {
+		s.buf = append(s.buf, 0)[:len(s.buf)]
+	}
+
+	for {
+		n, err := s.r.Read(s.buf[len(s.buf):cap(s.buf)])
+		s.buf = s.buf[:len(s.buf)+n]
+		if err != nil {
+			s.done = true
+			if err != io.EOF {
+				s.err = err
+			}
+			return n > 0
+		}
+		if n > 0 {
+			return true
+		}
+	}
+}
+
+// countLines updates the line accounting up to the read position.
+func (s *scanner) countLines() {
+	chunk := s.buf[s.counted:s.pos]
+	if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+		s.line += bytes.Count(chunk, []byte{'\n'})
+		s.lineStart = s.offset + int64(s.counted+i+1)
+	}
+	s.counted = s.pos
+}
+
+// InputPos returns the line and column following the last token.
+func (s *scanner) InputPos() (int, int) {
+	s.countLines()
+	return s.line, int(s.InputOffset()-s.lineStart) + 1
+}
+
+// InputOffset returns the offset following the last token.
+func (s *scanner) InputOffset() int64 {
+	return s.offset + int64(s.pos)
+}
+
+func (s *scanner) peek() (byte, bool) {
+	if s.pos >= len(s.buf) && !s.fill() {
+		return 0, false
+	}
+	return s.buf[s.pos], true
+}
+
+func (s *scanner) readByte() (byte, bool) {
+	b, ok := s.peek()
+	if ok {
+		s.pos++
+	}
+	return b, ok
+}
+
+// hasPrefix returns true when the unread input starts with the passed
+// string.
+func (s *scanner) hasPrefix(prefix string) bool {
+	for len(s.buf)-s.pos < len(prefix) {
+		if !s.fill() {
+			return false
+		}
+	}
+	return string(s.buf[s.pos:s.pos+len(prefix)]) == prefix
+}
+
+func (s *scanner) syntaxError(format string, args ...any) error {
+	s.countLines()
+	return &xml.SyntaxError{Msg: fmt.Sprintf(format, args...), Line: s.line}
+}
+
+// eof returns the error for an input ending in the middle of a token.
+func (s *scanner) eof() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.syntaxError("unexpected EOF")
+}
+
+func (s *scanner) Token() (xml.Token, error) {
+	if s.empty {
+		s.empty = false
+		s.close()
+		return s.end, nil
+	}
+
+	for {
+		b, ok := s.peek()
+		if !ok {
+			if s.err != nil {
+				return nil, s.err
+			}
+			if len(s.open) > 0 {
+				return nil, s.syntaxError("unexpected EOF")
+			}
+			return nil, io.EOF
+		}
+
+		if b != '<' {
+			return s.charData()
+		}
+
+		s.pos++
+		b, ok = s.readByte()
+		if !ok {
+			return nil, s.eof()
+		}
+
+		switch b {
+		case '/':
+			return s.endElement()
+		case '?':
+			if err := s.procInst(); err != nil {
+				return nil, err
+			}
+		case '!':
+			t, err := s.declaration()
+			if t != nil || err != nil {
+				return t, err
+			}
+		default:
+			s.pos--
+			return s.startElement()
+		}
+	}
+}
+
+// charData reads text up to the next tag.
+func (s *scanner) charData() (xml.Token, error) {
+	s.text = s.text[:0]
+	for {
+		b, ok := s.peek()
+		if !ok || b == '<' {
+			return xml.CharData(s.text), nil
+		}
+
+		start := s.pos
+		for s.pos < len(s.buf) {
+			b = s.buf[s.pos]
+			if b == '<' || b == '&' || b == '\r' {
+				break
+			}
+			s.pos++
+		}
+		s.text = append(s.text, s.buf[start:s.pos]...)
+
+		if s.pos < len(s.buf) {
+			var err error
+			if s.text, err = s.special(s.text); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// special handles the character at the read position when it is an entity
+// reference or a carriage return, appending the result to text.
+func (s *scanner) special(text []byte) ([]byte, error) {
+	switch s.buf[s.pos] {
+	case '&':
+		s.pos++
+		return s.entity(text)
+	case '\r':
+		// Line endings are normalized like encoding/xml does.
+		s.pos++
+		if b, ok := s.peek(); ok && b == '\n' {
+			s.pos++
+		}
+		return append(text, '\n'), nil
+	}
+	return text, nil
+}
+
+// entity reads an entity reference following '&'.
+func (s *scanner) entity(text []byte) ([]byte, error) {
+	s.scratch = s.scratch[:0]
+	for {
+		b, ok := s.readByte()
+		if !ok {
+			return nil, s.eof()
+		}
+		if b == ';' {
+			break
+		}
+		if len(s.scratch) > 16 || b == '<' || b == '&' || isSpace(b) {
+			return nil, s.syntaxError("invalid character entity &%s", s.scratch)
+		}
+		s.scratch = append(s.scratch, b)
+	}
+
+	name := string(s.scratch)
+	switch name {
+	case "lt":
+		return append(text, '<'), nil
+	case "gt":
+		return append(text, '>'), nil
+	case "amp":
+		return append(text, '&'), nil
+	case "apos":
+		return append(text, '\''), nil
+	case "quot":
+		return append(text, '"'), nil
+	}
+
+	if num, ok := strings.CutPrefix(name, "#"); ok {
+		base := 10
+		if hex, ok := strings.CutPrefix(num, "x"); ok {
+			num, base = hex, 16
+		}
+
+		n, err := strconv.ParseUint(num, base, 32)
+		if err == nil && utf8.ValidRune(rune(n)) {
+			return utf8.AppendRune(text, rune(n)), nil
+		}
+	}
+
+	return nil, s.syntaxError("invalid character entity &%s;", name)
+}
+
+// name reads a name, returning it interned.
+func (s *scanner) name() (string, error) {
+	s.scratch = s.scratch[:0]
+	for {
+		b, ok := s.peek()
+		if !ok {
+			return "", s.eof()
+		}
+		if !isNameByte(b) || (len(s.scratch) == 0 && (b == '-' || b == '.' || ('0' <= b && b <= '9'))) {
+			break
+		}
+		s.scratch = append(s.scratch, b)
+		s.pos++
+	}
+
+	if len(s.scratch) == 0 {
+		return "", s.syntaxError("expected name")
+	}
+
+	if name, ok := s.names[string(s.scratch)]; ok {
+		return name, nil
+	}
+
+	name := string(s.scratch)
+	if len(s.names) < 4096 {
+		s.names[name] = name
+	}
+	return name, nil
+}
+
+func isNameByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		b == '_' || b == ':' || b == '-' || b == '.' || b >= 0x80
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func (s *scanner) skipSpace() bool {
+	for {
+		b, ok := s.peek()
+		if !ok {
+			return false
+		}
+		if !isSpace(b) {
+			return true
+		}
+		s.pos++
+	}
+}
+
+// splitName splits a qualified name like encoding/xml does.
+func splitName(qname string) xml.Name {
+	if space, local, ok := strings.Cut(qname, ":"); ok && space != "" && local != "" {
+		return xml.Name{Space: space, Local: local}
+	}
+	return xml.Name{Local: qname}
+}
+
+// startElement reads a start tag.
+func (s *scanner) startElement() (xml.Token, error) {
+	qname, err := s.name()
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []xml.Attr
+	empty := false
+	for {
+		if !s.skipSpace() {
+			return nil, s.eof()
+		}
+
+		b := s.buf[s.pos]
+		if b == '>' {
+			s.pos++
+			break
+		}
+		if b == '/' {
+			s.pos++
+			if b, ok := s.readByte(); !ok || b != '>' {
+				return nil, s.syntaxError("expected /> in element")
+			}
+			empty = true
+			break
+		}
+
+		attr, err := s.attr()
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	// Bind the declared namespaces before translating the names.
+	s.marks = append(s.marks, len(s.ns))
+	for _, attr := range attrs {
+		switch {
+		case attr.Name.Space == "xmlns":
+			s.ns = append(s.ns, binding{prefix: attr.Name.Local, url: attr.Value})
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			s.ns = append(s.ns, binding{url: attr.Value})
+		}
+	}
+
+	for i := range attrs {
+		s.translate(&attrs[i].Name, false)
+	}
+
+	t := xml.StartElement{Name: splitName(qname), Attr: attrs}
+	s.translate(&t.Name, true)
+	s.open = append(s.open, qname)
+	if empty {
+		s.end = xml.EndElement{Name: t.Name}
+		s.empty = true
+	}
+
+	return t, nil
+}
+
+// attr reads an attribute.
+func (s *scanner) attr() (xml.Attr, error) {
+	qname, err := s.name()
+	if err != nil {
+		return xml.Attr{}, err
+	}
+
+	attr := xml.Attr{Name: splitName(qname)}
+	if !s.skipSpace() {
+		return attr, s.eof()
+	}
+	if s.buf[s.pos] != '=' {
+		return attr, s.syntaxError("attribute name without = in element")
+	}
+	s.pos++
+	if !s.skipSpace() {
+		return attr, s.eof()
+	}
+
+	quote := s.buf[s.pos]
+	if quote != '"' && quote != '\'' {
+		return attr, s.syntaxError("unquoted or missing attribute value in element")
+	}
+	s.pos++
+
+	s.text = s.text[:0]
+	for {
+		b, ok := s.peek()
+		if !ok {
+			return attr, s.eof()
+		}
+		if b == quote {
+			s.pos++
+			break
+		}
+		if b == '<' {
+			return attr, s.syntaxError("unescaped < inside quoted string")
+		}
+
+		start := s.pos
+		for s.pos < len(s.buf) {
+			b = s.buf[s.pos]
+			if b == quote || b == '<' || b == '&' || b == '\r' {
+				break
+			}
+			s.pos++
+		}
+		s.text = append(s.text, s.buf[start:s.pos]...)
+
+		if s.pos < len(s.buf) {
+			if s.text, err = s.special(s.text); err != nil {
+				return attr, err
+			}
+		}
+	}
+
+	attr.Value = string(s.text)
+	return attr, nil
+}
+
+// translate replaces a namespace prefix by the namespace URL it is bound
+// to, like encoding/xml does.
+func (s *scanner) translate(n *xml.Name, element bool) {
+	switch {
+	case n.Space == "xmlns":
+		return
+	case n.Space == "" && !element:
+		return
+	case n.Space == "xml":
+		n.Space = xmlURL
+		return
+	case n.Space == "" && n.Local == "xmlns":
+		return
+	}
+
+	for i := len(s.ns) - 1; i >= 0; i-- {
+		if s.ns[i].prefix == n.Space {
+			n.Space = s.ns[i].url
+			return
+		}
+	}
+}
+
+// endElement reads an end tag following "</".
+func (s *scanner) endElement() (xml.Token, error) {
+	qname, err := s.name()
+	if err != nil {
+		return nil, err
+	}
+	if !s.skipSpace() {
+		return nil, s.eof()
+	}
+	if s.buf[s.pos] != '>' {
+		return nil, s.syntaxError("invalid characters between </%s and >", qname)
+	}
+	s.pos++
+
+	if len(s.open) == 0 {
+		return nil, s.syntaxError("unexpected end element </%s>", qname)
+	}
+	if open := s.open[len(s.open)-1]; open != qname {
+		return nil, s.syntaxError("element <%s> closed by </%s>", open, qname)
+	}
+
+	t := xml.EndElement{Name: splitName(qname)}
+	s.translate(&t.Name, true)
+	s.close()
+	return t, nil
+}
+
+// close pops the current element and its namespace bindings.
+func (s *scanner) close() {
+	s.open = s.open[:len(s.open)-1]
+	s.ns = s.ns[:s.marks[len(s.marks)-1]]
+	s.marks = s.marks[:len(s.marks)-1]
+}
+
+// skipPast consumes the input up to the passed delimiter included.
+func (s *scanner) skipPast(delim string) error {
+	for {
+		i := bytes.Index(s.buf[s.pos:], []byte(delim))
+		if i >= 0 {
+			s.pos += i + len(delim)
+			return nil
+		}
+
+		// Keep the bytes which may start the delimiter.
+		s.pos = max(s.pos, len(s.buf)-len(delim)+1)
+		if !s.fill() {
+			return s.eof()
+		}
+	}
+}
+
+// procInst skips a processing instruction following "<?", checking the
+// encoding of an XML declaration.
+func (s *scanner) procInst() error {
+	target, err := s.name()
+	if err != nil {
+		return err
+	}
+
+	if target != "xml" {
+		return s.skipPast("?>")
+	}
+
+	s.scratch = s.scratch[:0]
+	for !s.hasPrefix("?>") {
+		b, ok := s.readByte()
+		if !ok {
+			return s.eof()
+		}
+		s.scratch = append(s.scratch, b)
+	}
+	s.pos += 2
+
+	decl := string(s.scratch)
+	if v := declValue(decl, "version"); v != "" && v != "1.0" {
+		return s.syntaxError("unsupported version %q; only version 1.0 is supported", v)
+	}
+
+	enc := declValue(decl, "encoding")
+	if err := s.conv.declare(enc); err != nil {
+		return err
+	}
+	if enc == "" || charsetName(enc) == "utf-8" || s.conv.encoding != "" {
+		return nil
+	}
+
+	// The rest of the input is converted to UTF-8, UTF-16 inputs being
+	// already converted by NewUTF8Reader.
+	rest := bytes.Clone(s.buf[s.pos:])
+	r, err := s.conv.reader(enc, io.MultiReader(bytes.NewReader(rest), s.r))
+	if err != nil {
+		return err
+	}
+
+	s.countLines()
+	s.offset += int64(s.pos)
+	s.buf = s.buf[:0]
+	s.pos = 0
+	s.counted = 0
+	s.done = false
+	s.r = r
+	return nil
+}
+
+// declValue returns the value of a pseudo-attribute of an XML declaration.
+func declValue(decl string, name string) string {
+	i := strings.Index(decl, name)
+	if i < 0 {
+		return ""
+	}
+
+	rest := strings.TrimLeft(decl[i+len(name):], " \t\r\n")
+	rest, ok := strings.CutPrefix(rest, "=")
+	if !ok {
+		return ""
+	}
+
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+		return ""
+	}
+
+	value, _, _ := strings.Cut(rest[1:], rest[:1])
+	return value
+}
+
+// declaration reads a comment, a CDATA section or a DOCTYPE declaration
+// following "<!". Only CDATA sections produce a token.
+func (s *scanner) declaration() (xml.Token, error) {
+	switch {
+	case s.hasPrefix("--"):
+		s.pos += 2
+		if err := s.skipPast("--"); err != nil {
+			return nil, err
+		}
+		if b, ok := s.readByte(); !ok {
+			return nil, s.eof()
+		} else if b != '>' {
+			return nil, s.syntaxError(`invalid sequence "--" not allowed in comments`)
+		}
+		return nil, nil
+	case s.hasPrefix("[CDATA["):
+		s.pos += 7
+		return s.cdata()
+	}
+
+	// A DOCTYPE declaration, possibly with an internal subset containing
+	// markup declarations, quoted strings and comments.
+	depth := 1
+	var quote byte
+	for depth > 0 {
+		if quote == 0 && s.hasPrefix("<!--") {
+			s.pos += 4
+			if err := s.skipPast("-->"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		b, ok := s.readByte()
+		if !ok {
+			return nil, s.eof()
+		}
+
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '"' || b == '\'':
+			quote = b
+		case b == '<':
+			depth++
+		case b == '>':
+			depth--
+		}
+	}
+
+	return nil, nil
+}
+
+// cdata reads a CDATA section following "<![CDATA[".
+func (s *scanner) cdata() (xml.Token, error) {
+	s.text = s.text[:0]
+	for {
+		if s.hasPrefix("]]>") {
+			s.pos += 3
+			return xml.CharData(s.text), nil
+		}
+
+		b, ok := s.peek()
+		if !ok {
+			return nil, s.eof()
+		}
+
+		if b == '\r' {
+			s.text, _ = s.special(s.text)
+			continue
+		}
+
+		s.text = append(s.text, b)
+		s.pos++
+	}
+}
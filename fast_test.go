@@ -0,0 +1,200 @@
+package exml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+// A conformanceEvent is a token of a document along with the offset
+// following it, text being merged and offsets being only compared for
+// elements.
+type conformanceEvent struct {
+	Token  string
+	Offset int64
+}
+
+func conformanceEvents(tr xml.TokenReader) ([]conformanceEvent, error) {
+	pos := tr.(positioner)
+	events := []conformanceEvent{}
+	text := []byte{}
+
+	flush := func() {
+		if len(text) > 0 {
+			events = append(events, conformanceEvent{Token: fmt.Sprintf("text %q", text), Offset: -1})
+			text = text[:0]
+		}
+	}
+
+	for {
+		t, err := tr.Token()
+		if err == io.EOF {
+			flush()
+			return events, nil
+		}
+		if err != nil {
+			return events, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			flush()
+			attrs := []string{}
+			for _, attr := range t.Attr {
+				attrs = append(attrs, fmt.Sprintf("{%s}%s=%q", attr.Name.Space, attr.Name.Local, attr.Value))
+			}
+			events = append(events, conformanceEvent{
+				Token:  fmt.Sprintf("start {%s}%s %s", t.Name.Space, t.Name.Local, strings.Join(attrs, " ")),
+				Offset: pos.InputOffset(),
+			})
+		case xml.EndElement:
+			flush()
+			events = append(events, conformanceEvent{
+				Token:  fmt.Sprintf("end {%s}%s", t.Name.Space, t.Name.Local),
+				Offset: pos.InputOffset(),
+			})
+		case xml.CharData:
+			text = append(text, t...)
+		}
+	}
+}
+
+var conformanceCorpus = []string{
+	EXAMPLE, ATTRIBUTE, NAMESPACED, SIMPLE, TEXT, CDATA, MIXED, ASSIGN, APPEND, NESTED_TEXT,
+	PUSH, DUMP, EVENTS[:strings.Index(EVENTS, "<log:event id=\"2\"")] + "</log:events>",
+	DOCUMENTS,
+	`<a>x &lt; y &gt; z &amp;&amp; &apos;q&apos; &quot;Q&quot; &#65;&#x42;&#x1F600; &#233;</a>`,
+	"<a attr=\"line1\r\nline2\rline3\">text\r\nwith\rbreaks<![CDATA[cdata\r\nbreak]]></a>",
+	`<!DOCTYPE note [
+  <!ELEMENT note (#PCDATA)>
+  <!ENTITY writer "Donald <Duck>">
+  <!-- a comment with > and < -->
+]>
+<note xml:lang="en" a='single "quoted"' b="double 'quoted'"><?pi data?>text<!-- comment --> more</note>`,
+	`<root xmlns="urn:default" xmlns:p="urn:p">
+  <child p:attr="1" attr="2"><p:inner xmlns:p="urn:other" p:x="y"/></child>
+  <reset xmlns=""><plain/></reset>
+  <unbound:el unbound:attr="v"/>
+</root>`,
+	`<a><b/><c></c><d   /><e
+   f = "g"
+/></a>`,
+	"<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a>caf\xe9 \xa4</a>",
+	"\xef\xbb\xbf<?xml version=\"1.0\"?><a>bom</a>",
+	"\xff\xfe<\x00a\x00>\x00\xe9\x00<\x00/\x00a\x00>\x00",
+	"<a>été 日本</a>",
+	string(largeCatalog(50)),
+	records(20),
+	shardedDump(10),
+}
+
+var malformedCorpus = []string{
+	MALFORMED,
+	"<a>",
+	"<a><b></a>",
+	"<a>&unknown;</a>",
+	"<a>&#xZZ;</a>",
+	"<a b=c/>",
+	"<a b/>",
+	"<a b='<'/>",
+	"<a",
+	"<a></a",
+	"<a><!-- x -- y --></a>",
+	"<a><![CDATA[open</a>",
+	"</a>",
+	"<a>text",
+	"<?xml version=\"1.1\"?><a/>",
+}
+
+func newConformanceDecoder(data string) *xml.Decoder {
+	d := xml.NewDecoder(NewUTF8Reader(strings.NewReader(data)))
+	d.CharsetReader = CharsetReader
+	return d
+}
+
+func (s *EXMLSuite) Test_FastConformance(c *check.C) {
+	for i, doc := range conformanceCorpus {
+		expected, err := conformanceEvents(newConformanceDecoder(doc))
+		c.Assert(err, check.IsNil, check.Commentf("document %d", i))
+
+		for _, size := range []int{1, 7, 4096} {
+			r := &chunkedReader{data: []byte(doc), size: size}
+			events, err := conformanceEvents(newScanner(NewUTF8Reader(r)))
+			c.Assert(err, check.IsNil, check.Commentf("document %d", i))
+			c.Assert(events, check.DeepEquals, expected, check.Commentf("document %d, chunks of %d", i, size))
+		}
+	}
+}
+
+func (s *EXMLSuite) Test_FastMalformed(c *check.C) {
+	for i, doc := range malformedCorpus {
+		_, err := conformanceEvents(newConformanceDecoder(doc))
+		c.Assert(err, check.NotNil, check.Commentf("document %d", i))
+
+		_, err = conformanceEvents(newScanner(NewUTF8Reader(strings.NewReader(doc))))
+		c.Assert(err, check.FitsTypeOf, &xml.SyntaxError{}, check.Commentf("document %d", i))
+	}
+}
+
+func (s *EXMLSuite) Test_FastDecoder(c *check.C) {
+	decoder := NewFastDecoder(strings.NewReader(EXAMPLE))
+	addressBook := AddressBook{}
+	decoder.On("address-book", func(attrs Attrs) {
+		addressBook.Name, _ = attrs.Get("name")
+		decoder.On("contact", func(attrs Attrs) {
+			contact := &Contact{}
+			addressBook.Contacts = append(addressBook.Contacts, contact)
+			decoder.OnTextOf("first-name", Assign(&contact.FirstName))
+			decoder.OnTextOf("last-name", Assign(&contact.LastName))
+			decoder.OnTextOf("address", Assign(&contact.Address))
+		})
+	})
+
+	var cbErr *CallbackError
+	decoder.OnTextOfE("zip", func(text CharData) error {
+		return errCallback
+	})
+
+	err := decoder.Run()
+	c.Assert(err, check.FitsTypeOf, cbErr)
+	cbErr = err.(*CallbackError)
+	c.Assert(cbErr.Path, check.Equals, "address-book/contact/zip")
+	c.Assert(cbErr.Line, check.Equals, 7)
+	c.Assert(cbErr.Column, check.Equals, 19)
+	c.Assert(addressBook.Name, check.Equals, "homies")
+	c.Assert(addressBook.Contacts, check.HasLen, 1)
+	c.Assert(*addressBook.Contacts[0], check.Equals, Contact{"Tim", "Cook", "Cupertino"})
+
+	count, err := decodeCatalog(largeCatalog(100), NewFastDecoder)
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 100)
+}
+
+// A chunkedReader returns its data in chunks of a given size.
+type chunkedReader struct {
+	data []byte
+	size int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p[:min(len(p), r.size)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func Benchmark_FastDecodeLarge(b *testing.B) {
+	data := largeCatalog(20000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		decodeCatalog(data, NewFastDecoder)
+	}
+}
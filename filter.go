@@ -0,0 +1,311 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"slices"
+)
+
+// Filter returns a token reader forwarding the tokens read from tr while
+// dispatching them to a decoder configured by setup, so that exml handlers
+// can be used in an encoding/xml pipeline, for example to extract data on
+// the side of an xml.Decoder.Decode call.
+//
+// Tag callbacks can modify the values of the attributes they get, which are
+// forwarded, and the callbacks can alter the output with the Drop, Replace,
+// Inject, Rename, SetAttr and RemoveAttr methods of the decoder. The text
+// tokens of an element are held back until its text callback was called,
+// so that it can alter them as well. The comments, processing instructions
+// and directives found between two tags are held back along with the text,
+// so that dropping or replacing the text removes them too.
+func Filter(tr xml.TokenReader, setup func(*Decoder)) xml.TokenReader {
+	f := &filter{}
+	f.d = NewTokenDecoder(tr)
+	f.d.recordTokens(f.read)
+	f.d.filter = f
+	setup(f.d)
+	return f
+}
+
+type filterTarget int
+
+const (
+	targetNone filterTarget = iota
+	targetText
+	targetTag
+)
+
+// A filterAction records how a callback altered the output.
+type filterAction struct {
+	drop        bool
+	replacement []xml.Token
+	injected    []xml.Token
+	name        string
+	edits       []attrEdit
+}
+
+// An attrEdit records a call to SetAttr or RemoveAttr.
+type attrEdit struct {
+	name   string
+	value  string
+	remove bool
+}
+
+// A filterElement is an element open in the output of a filter.
+type filterElement struct {
+	name     xml.Name
+	rendered bool
+}
+
+type filter struct {
+	d   *Decoder
+	err error
+
+	out     []xml.Token
+	text    []xml.Token
+	target  filterTarget
+	onText  filterAction
+	onTag   filterAction
+	dropped int
+	open    []filterElement
+
+	// The raw input of the tokens is recorded in tape by transformers,
+	// along with the attributes of start elements before their dispatch.
+	tape  *tape
+	raw   []byte
+	attrs []xml.Attr
+}
+
+// read records the raw input of a token read by a transformer, along with
+// the attributes of start elements before their dispatch.
+func (f *filter) read(t xml.Token) {
+	if f.tape == nil {
+		return
+	}
+
+	f.raw = f.tape.take(f.d.recorder.InputOffset())
+	if start, ok := t.(xml.StartElement); ok {
+		f.attrs = append(f.attrs[:0], start.Attr...)
+	}
+}
+
+func (f *filter) Token() (xml.Token, error) {
+	for len(f.out) == 0 {
+		if f.err != nil {
+			return nil, f.err
+		}
+
+		token, done, err := f.d.step()
+		if done {
+			if err == nil {
+				f.emitText()
+				err = io.EOF
+			}
+			f.err = err
+			continue
+		}
+
+		f.forward(token)
+	}
+
+	t := f.out[0]
+	f.out = f.out[1:]
+	return t, nil
+}
+
+// forward handles the token which was just dispatched.
+func (f *filter) forward(token xml.Token) {
+	depth := len(f.d.stack)
+	switch t := token.(type) {
+	case xml.StartElement:
+		f.emitText()
+		action := f.onTag
+		f.onTag = filterAction{}
+		if f.dropped > 0 {
+			break
+		}
+
+		switch {
+		case action.drop:
+			f.dropped = depth
+		case action.replacement != nil:
+			f.out = append(f.out, action.replacement...)
+			f.dropped = depth
+		default:
+			rendered := f.tape == nil || action.name != "" || len(action.edits) > 0 ||
+				len(action.injected) > 0 || !slices.Equal(t.Attr, f.attrs)
+			if action.name != "" {
+				t.Name.Local = action.name
+			}
+			if len(action.edits) > 0 {
+				t.Attr = editAttrs(slices.Clone(t.Attr), action.edits)
+			}
+
+			f.open = append(f.open, filterElement{name: t.Name, rendered: rendered})
+			if rendered {
+				f.out = append(f.out, t)
+			} else {
+				f.out = append(f.out, rawToken{raw: f.raw, token: t})
+			}
+		}
+		f.out = append(f.out, action.injected...)
+
+	case xml.EndElement:
+		f.emitText()
+		if f.dropped > 0 {
+			if depth < f.dropped {
+				f.dropped = 0
+			}
+			break
+		}
+
+		e := f.open[len(f.open)-1]
+		f.open = f.open[:len(f.open)-1]
+		t.Name = e.name
+		if e.rendered {
+			f.out = append(f.out, t)
+		} else {
+			f.out = append(f.out, rawToken{raw: f.raw, token: t})
+		}
+
+	case nil:
+	default:
+		if f.dropped > 0 {
+			break
+		}
+		if f.tape != nil {
+			f.text = append(f.text, rawToken{raw: bytes.Clone(f.raw), token: xml.CopyToken(t)})
+		} else {
+			f.text = append(f.text, xml.CopyToken(t))
+		}
+	}
+}
+
+// editAttrs applies the passed edits to attrs.
+func editAttrs(attrs []xml.Attr, edits []attrEdit) []xml.Attr {
+	for _, e := range edits {
+		i := slices.IndexFunc(attrs, func(attr xml.Attr) bool {
+			return attr.Name.Local == e.name
+		})
+
+		switch {
+		case e.remove && i >= 0:
+			attrs = slices.Delete(attrs, i, i+1)
+		case e.remove:
+		case i >= 0:
+			attrs[i].Value = e.value
+		default:
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: e.name}, Value: e.value})
+		}
+	}
+
+	return attrs
+}
+
+// emitText outputs the text held back before a tag, as altered by the text
+// callback.
+func (f *filter) emitText() {
+	action := f.onText
+	f.onText = filterAction{}
+	text := f.text
+	f.text = f.text[:0]
+	if f.dropped > 0 {
+		return
+	}
+
+	switch {
+	case action.drop:
+	case action.replacement != nil:
+		f.out = append(f.out, action.replacement...)
+	default:
+		f.out = append(f.out, text...)
+	}
+	f.out = append(f.out, action.injected...)
+}
+
+func (f *filter) untarget() {
+	f.target = targetNone
+}
+
+// action returns the action altered by the running callback.
+func (f *filter) action() *filterAction {
+	switch f.target {
+	case targetText:
+		return &f.onText
+	case targetTag:
+		return &f.onTag
+	}
+	return nil
+}
+
+// Drop removes from the output of a filter the element whose tag callback
+// is running, along with its content, or the text whose text callback is
+// running. It does nothing for decoders which were not created by Filter or
+// NewTransformer.
+func (d *Decoder) Drop() {
+	if d.filter == nil {
+		return
+	}
+	if a := d.filter.action(); a != nil {
+		a.drop = true
+	}
+}
+
+// Replace replaces in the output of a filter the element whose tag callback
+// is running, along with its content, or the text whose text callback is
+// running, by the passed tokens. It does nothing for decoders which were not
+// created by Filter or NewTransformer.
+func (d *Decoder) Replace(tokens ...xml.Token) {
+	if d.filter == nil {
+		return
+	}
+	if a := d.filter.action(); a != nil {
+		a.replacement = append(make([]xml.Token, 0, len(tokens)), tokens...)
+	}
+}
+
+// Inject adds the passed tokens to the output of a filter, after the start
+// element whose tag callback is running or after the text whose text
+// callback is running. It does nothing for decoders which were not created
+// by Filter or NewTransformer.
+func (d *Decoder) Inject(tokens ...xml.Token) {
+	if d.filter == nil {
+		return
+	}
+	if a := d.filter.action(); a != nil {
+		a.injected = append(a.injected, tokens...)
+	}
+}
+
+// Rename renames in the output of a filter the element whose tag callback
+// is running, the namespace of the element being kept. It does nothing for
+// decoders which were not created by Filter or NewTransformer.
+func (d *Decoder) Rename(local string) {
+	if d.filter == nil || d.filter.target != targetTag {
+		return
+	}
+	d.filter.onTag.name = local
+}
+
+// SetAttr sets in the output of a filter the value of an attribute of the
+// element whose tag callback is running, the attribute being matched by
+// local name like with Attrs.Get and added when missing. It does nothing for
+// decoders which were not created by Filter or NewTransformer.
+func (d *Decoder) SetAttr(name, value string) {
+	if d.filter == nil || d.filter.target != targetTag {
+		return
+	}
+	d.filter.onTag.edits = append(d.filter.onTag.edits, attrEdit{name: name, value: value})
+}
+
+// RemoveAttr removes from the output of a filter an attribute of the
+// element whose tag callback is running, the attribute being matched by
+// local name like with Attrs.Get. It does nothing for decoders which were
+// not created by Filter or NewTransformer.
+func (d *Decoder) RemoveAttr(name string) {
+	if d.filter == nil || d.filter.target != targetTag {
+		return
+	}
+	d.filter.onTag.edits = append(d.filter.onTag.edits, attrEdit{name: name, remove: true})
+}
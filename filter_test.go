@@ -0,0 +1,128 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const FILTER = `<?xml version="1.0"?>
+<users>
+    <user id="1" password="secret"><name>Alice</name><email>alice@example.com</email><notes>VIP</notes></user>
+    <user id="2" password="hunter2"><name>Bob</name><email>bob@example.com</email><notes>none</notes></user>
+    <!-- end of users -->
+</users>`
+
+type filterUser struct {
+	ID       string `xml:"id,attr"`
+	Password string `xml:"password,attr"`
+	Name     string `xml:"name"`
+	Email    string `xml:"email"`
+	Notes    string `xml:"notes"`
+	Role     string `xml:"role"`
+}
+
+type filterUsers struct {
+	Users []filterUser `xml:"user"`
+}
+
+func (s *EXMLSuite) Test_FilterSideChannel(c *check.C) {
+	ids := []string{}
+	tr := Filter(xml.NewDecoder(strings.NewReader(FILTER)), func(d *Decoder) {
+		d.On("users/user", func(attrs Attrs) {
+			id, _ := attrs.Get("id")
+			ids = append(ids, id)
+		})
+	})
+
+	users := filterUsers{}
+	c.Assert(xml.NewTokenDecoder(tr).Decode(&users), check.IsNil)
+	c.Assert(ids, check.DeepEquals, []string{"1", "2"})
+	c.Assert(users.Users, check.HasLen, 2)
+	c.Assert(users.Users[1], check.Equals, filterUser{ID: "2", Password: "hunter2", Name: "Bob", Email: "bob@example.com", Notes: "none"})
+}
+
+func (s *EXMLSuite) Test_FilterAlterations(c *check.C) {
+	emails := []string{}
+	tr := Filter(xml.NewDecoder(strings.NewReader(FILTER)), func(d *Decoder) {
+		d.On("user", func(attrs Attrs) {
+			for i := range attrs {
+				if attrs[i].Name.Local == "password" {
+					attrs[i].Value = "***"
+				}
+			}
+
+			role := xml.StartElement{Name: xml.Name{Local: "role"}}
+			d.Inject(role, xml.CharData("member"), role.End())
+
+			d.OnTextOf("email", func(text CharData) {
+				emails = append(emails, string(text))
+				d.Replace(xml.CharData("redacted"))
+			})
+			d.OnTextOf("name", func(text CharData) {
+				d.Inject(xml.CharData(" Smith"))
+			})
+			d.On("notes", func(attrs Attrs) {
+				d.Drop()
+			})
+		})
+	})
+
+	var out bytes.Buffer
+	encoder := xml.NewEncoder(&out)
+	for {
+		t, err := tr.Token()
+		if err != nil {
+			break
+		}
+		c.Assert(encoder.EncodeToken(t), check.IsNil)
+	}
+	c.Assert(encoder.Flush(), check.IsNil)
+
+	c.Assert(emails, check.DeepEquals, []string{"alice@example.com", "bob@example.com"})
+	c.Assert(strings.Contains(out.String(), `<user id="1" password="***"><role>member</role><name>Alice Smith</name><email>redacted</email></user>`), check.Equals, true, check.Commentf(out.String()))
+	c.Assert(strings.Contains(out.String(), "<!-- end of users -->"), check.Equals, true)
+
+	users := filterUsers{}
+	c.Assert(xml.Unmarshal(out.Bytes(), &users), check.IsNil)
+	c.Assert(users.Users[1], check.Equals, filterUser{ID: "2", Password: "***", Name: "Bob Smith", Email: "redacted", Role: "member"})
+}
+
+func (s *EXMLSuite) Test_FilterHeldComments(c *check.C) {
+	const doc = `<a>one<!-- note --><?pi x?>two<b>three<!-- kept --></b></a>`
+	tr := Filter(xml.NewDecoder(strings.NewReader(doc)), func(d *Decoder) {
+		d.OnTextOf("a", func(text CharData) {
+			d.Replace(xml.CharData("replaced"))
+		})
+	})
+
+	var out bytes.Buffer
+	encoder := xml.NewEncoder(&out)
+	for {
+		t, err := tr.Token()
+		if err != nil {
+			break
+		}
+		c.Assert(encoder.EncodeToken(t), check.IsNil)
+	}
+	c.Assert(encoder.Flush(), check.IsNil)
+	c.Assert(out.String(), check.Equals, `<a>replaced<b>three<!-- kept --></b></a>`)
+}
+
+func (s *EXMLSuite) Test_FilterErrors(c *check.C) {
+	tr := Filter(xml.NewDecoder(strings.NewReader(FILTER)), func(d *Decoder) {
+		d.OnTextOfE("user/name", func(text CharData) error {
+			if string(text) == "Bob" {
+				return errCallback
+			}
+			return nil
+		})
+	})
+
+	users := filterUsers{}
+	err := xml.NewTokenDecoder(tr).Decode(&users)
+	c.Assert(err, check.FitsTypeOf, &CallbackError{})
+	c.Assert(err.(*CallbackError).Line, check.Equals, 4)
+}
@@ -0,0 +1,209 @@
+package exml
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// NewHTMLDecoder creates a new exml parser suited to HTML documents and
+// other tag soups. The underlying xml.Decoder is configured in non strict
+// mode with the HTML entities, element and attribute names are matched
+// case insensitively (they are lowercased before being passed to the
+// callbacks), void elements such as <br> or <img> don't need to be closed,
+// end tags close any unclosed element they contain, stray end tags are
+// ignored and elements left open at the end of the input are closed.
+// Some end tags are also implied, for example a <li> closes the previous
+// <li> of the same list. The content of <script> and <style> elements is
+// passed as is to the text callbacks, up to their end tag, without being
+// parsed. This is not the case for documents in an encoding other than
+// UTF-8, whose scripts and styles must not contain '<' or '&'.
+func NewHTMLDecoder(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.decoder.Strict = false
+	d.decoder.Entity = xml.HTMLEntity
+	d.source = &rawTokenReader{d: d}
+	d.html = true
+	return d
+}
+
+// A rawTokenReader reads raw tokens from the xml.Decoder of an HTML decoder
+// so that unbalanced end tags don't stop the parsing. The content of script
+// and style elements is read as raw text before it reaches the xml.Decoder.
+type rawTokenReader struct {
+	d       *Decoder
+	rawText string
+}
+
+func (r *rawTokenReader) Token() (xml.Token, error) {
+	if name := r.rawText; name != "" {
+		r.rawText = ""
+		text, err := r.d.readRawText(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(text) > 0 {
+			return text, nil
+		}
+	}
+
+	t, err := r.d.decoder.RawToken()
+	if start, ok := t.(xml.StartElement); ok && r.isRawText(start) {
+		r.rawText = start.Name.Local
+	}
+	return t, err
+}
+
+// isRawText returns true when the content of the element started by the
+// token which was just read must be read as raw text.
+func (r *rawTokenReader) isRawText(t xml.StartElement) bool {
+	if t.Name.Space != "" || !rawTextElements[strings.ToLower(t.Name.Local)] {
+		return false
+	}
+
+	// The converted input of the xml.Decoder can't be read from the stream,
+	// and a self-closing tag has no content.
+	if r.d.conversion != nil && r.d.conversion.encoding != "" {
+		return false
+	}
+	return r.d.stream.last[0] != '/'
+}
+
+var rawTextElements = map[string]bool{"script": true, "style": true}
+
+// readRawText reads from the input the content of a script or style
+// element up to its end tag, which is read again by a new xml.Decoder
+// primed at its position. The content runs to the end of the input when
+// the end tag is missing.
+func (d *Decoder) readRawText(name string) (xml.CharData, error) {
+	line, column, offset := d.position()
+	var text []byte
+	for {
+		b, err := d.stream.ReadByte()
+		if err == io.EOF {
+			return text, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		text = append(text, b)
+
+		// The name of the end tag must be followed by a space, '/' or '>'.
+		end := len(text) - len(name) - 3
+		if end < 0 || text[end] != '<' || text[end+1] != '/' ||
+			!strings.EqualFold(string(text[end+2:len(text)-1]), name) ||
+			!strings.ContainsRune(" \t\n\r\f/>", rune(b)) {
+			continue
+		}
+
+		tag := text[end:]
+		text = text[:end]
+		for _, b := range text {
+			column++
+			if b == '\n' {
+				line++
+				column = 1
+			}
+		}
+
+		if err := d.prime(d.stream, nil, offset+int64(len(text)), line, column); err != nil {
+			return nil, err
+		}
+		d.stream.prelude = tag
+		return text, nil
+	}
+}
+
+// foldCase lowercases the names of an HTML element and of its attributes.
+func foldCase(t *xml.StartElement) {
+	t.Name.Local = strings.ToLower(t.Name.Local)
+	for i := range t.Attr {
+		t.Attr[i].Name.Local = strings.ToLower(t.Attr[i].Name.Local)
+	}
+}
+
+var voidElements = func() map[string]bool {
+	m := make(map[string]bool, len(xml.HTMLAutoClose))
+	for _, name := range xml.HTMLAutoClose {
+		m[name] = true
+	}
+	return m
+}()
+
+func isVoidElement(name string) bool {
+	return voidElements[name]
+}
+
+// impliedEnds maps the elements which implicitly close an open element of
+// the same name to the elements delimiting the scope of that search.
+var impliedEnds = map[string][]string{
+	"li":       {"ul", "ol", "menu"},
+	"dt":       {"dl"},
+	"dd":       {"dl"},
+	"option":   {"select", "datalist", "optgroup"},
+	"optgroup": {"select"},
+	"tr":       {"table", "thead", "tbody", "tfoot"},
+	"td":       {"tr", "table"},
+	"th":       {"tr", "table"},
+	"thead":    {"table"},
+	"tbody":    {"table"},
+	"tfoot":    {"table"},
+}
+
+// blockElements are the elements which implicitly close an open paragraph.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"div": true, "dl": true, "fieldset": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "table": true, "ul": true,
+}
+
+var paragraphScope = []string{"div", "td", "th", "li", "body", "section", "article", "blockquote"}
+
+// closeImplied closes the open elements implicitly ended by the start of an
+// element with the passed name.
+func (d *Decoder) closeImplied(name string) error {
+	if blockElements[name] {
+		if err := d.closeInScope("p", paragraphScope); err != nil {
+			return err
+		}
+	}
+
+	if scope, ok := impliedEnds[name]; ok {
+		return d.closeInScope(name, scope)
+	}
+
+	return nil
+}
+
+// closeInScope closes the innermost open element with the passed name
+// unless one of the scope elements is found first.
+func (d *Decoder) closeInScope(name string, scope []string) error {
+	for i := len(d.stack) - 1; i >= 0; i-- {
+		open := d.stack[i].name.Local
+		if open == name {
+			return d.popElements(i)
+		}
+
+		for _, s := range scope {
+			if open == s {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// findOpen returns the index of the innermost open element with the passed
+// name, or -1 when there is none.
+func (d *Decoder) findOpen(name string) int {
+	for i := len(d.stack) - 1; i >= 0; i-- {
+		if d.stack[i].name.Local == name {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,116 @@
+package exml
+
+import (
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const HTML = `<!DOCTYPE html>
+<HTML>
+<head><title>Report &copy; 2024</title><META charset="utf-8"></head>
+<body>
+    <UL id="items">
+        <li>Item 1
+        <li>Item <b>2</li>
+        <LI CLASS="last">Item 3
+    </ul>
+    <p>First paragraph<br>with a break
+    <p>Second paragraph</span>
+    <table><tr><td>A<td>B<tr><td>C</table>
+    <div>Unclosed
+</body>`
+
+func (s *EXMLSuite) Test_HTML(c *check.C) {
+	decoder := NewHTMLDecoder(strings.NewReader(HTML))
+
+	var title string
+	var charset string
+	items := []string{}
+	classes := []string{}
+	paragraphs := []string{}
+	cells := []string{}
+	divs := []string{}
+
+	decoder.OnTextOf("html/head/title", Assign(&title))
+	decoder.On("html/head/meta", func(attrs Attrs) {
+		charset, _ = attrs.Get("charset")
+	})
+	decoder.On("HTML/Body", func(attrs Attrs) {
+		decoder.On("ul/li", func(attrs Attrs) {
+			classes = append(classes, attrs.GetString("class", ""))
+			decoder.OnText(Append(&items))
+		})
+		decoder.OnTextOf("p", Append(&paragraphs))
+		decoder.OnTextOf("table/tr/td", Append(&cells))
+		decoder.OnTextOf("div", Append(&divs))
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(title, check.Equals, "Report © 2024")
+	c.Assert(charset, check.Equals, "utf-8")
+	c.Assert(items, check.DeepEquals, []string{"Item 1", "Item", "Item 3"})
+	c.Assert(classes, check.DeepEquals, []string{"", "", "last"})
+	c.Assert(paragraphs, check.DeepEquals, []string{"First paragraph", "with a break", "Second paragraph"})
+	c.Assert(cells, check.DeepEquals, []string{"A", "B", "C"})
+	c.Assert(divs, check.DeepEquals, []string{"Unclosed"})
+}
+
+func (s *EXMLSuite) Test_HTMLSkip(c *check.C) {
+	decoder := NewHTMLDecoder(strings.NewReader(HTML))
+	decoder.SetErrorPolicy(SkipOnError)
+
+	itemNum := 0
+	items := []string{}
+	decoder.OnE("ul/li", func(attrs Attrs) error {
+		itemNum = itemNum + 1
+		if itemNum == 2 {
+			return errCallback
+		}
+		decoder.OnText(Append(&items))
+		return nil
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(items, check.DeepEquals, []string{"Item 1", "Item 3"})
+}
+
+const HTML_SCRIPTS = `<html><head>
+<script>if (a < b && c) { s = "</scripts>" }</script>
+<STYLE type="text/css">p > b { content: "<&>" }</Style >
+<script src="x.js"/>
+<script></script>
+</head><body><p>Text &amp; more</p>
+<p id="last">Done</p></body>
+<script>unterminated < script`
+
+func (s *EXMLSuite) Test_HTMLRawText(c *check.C) {
+	scripts := []string{}
+	styles := []string{}
+	paragraphs := []string{}
+	decoder := NewHTMLDecoder(strings.NewReader(HTML_SCRIPTS))
+	decoder.OnTextOf("html/head/script", Append(&scripts))
+	decoder.OnTextOf("html/head/style", Append(&styles))
+	decoder.OnTextOf("html/script", Append(&scripts))
+	decoder.OnTextOf("html/body/p", Append(&paragraphs))
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(scripts, check.DeepEquals, []string{`if (a < b && c) { s = "</scripts>" }`, "unterminated < script"})
+	c.Assert(styles, check.DeepEquals, []string{`p > b { content: "<&>" }`})
+	c.Assert(paragraphs, check.DeepEquals, []string{"Text & more", "Done"})
+
+	// The positions after the raw text are those of the whole input.
+	decoder = NewHTMLDecoder(strings.NewReader(HTML_SCRIPTS))
+	decoder.OnE("html/body/p", func(attrs Attrs) error {
+		if attrs.GetString("id", "") == "last" {
+			return errCallback
+		}
+		return nil
+	})
+
+	err := decoder.Run()
+	cbErr, ok := err.(*CallbackError)
+	c.Assert(ok, check.Equals, true, check.Commentf("%v", err))
+	c.Assert(cbErr.Line, check.Equals, 7)
+	c.Assert(cbErr.Column, check.Equals, 1)
+	c.Assert(cbErr.Offset, check.Equals, int64(strings.Index(HTML_SCRIPTS, `<p id="last">`)))
+}
@@ -0,0 +1,300 @@
+package exml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrKeyNotFound is returned by Index.Decode for keys which are not indexed.
+var ErrKeyNotFound = errors.New("exml: key not found in index")
+
+// An Index records the byte ranges of the elements found at a path in a
+// UTF-8 document, by the value of one of their attributes, so that a single
+// element can be parsed without reading the whole document. The enclosing
+// elements of every indexed element are recorded as well, with their
+// attributes and namespace declarations.
+type Index struct {
+	contexts [][]xml.StartElement
+	entries  []indexEntry
+	keys     map[string]int
+}
+
+type indexEntry struct {
+	key     string
+	context int
+	start   int64
+	end     int64
+	line    int
+	column  int
+}
+
+// BuildIndex parses the document read from r and indexes the elements
+// matching path, as passed to Decoder.On, by the value of their keyAttr
+// attribute, which may be written "@id" as well as "id". Elements without
+// this attribute are not indexed, and an element nested in an indexed one
+// is not indexed either. When several elements have the same key, the first
+// one is indexed.
+func BuildIndex(r io.Reader, path string, keyAttr string) (*Index, error) {
+	keyAttr = strings.TrimPrefix(keyAttr, "@")
+	idx := &Index{keys: map[string]int{}}
+	contexts := map[string]int{}
+
+	d := NewDecoder(r)
+	var current *indexEntry
+	depth := 0
+	d.On(path, func(attrs Attrs) {
+		key, ok := attrs.Get(keyAttr)
+		if current != nil || !ok {
+			return
+		}
+
+		open := make([]xml.StartElement, len(d.stack)-1)
+		for i, f := range d.stack[:len(open)] {
+			open[i] = xml.StartElement{Name: f.name, Attr: f.attr}
+		}
+
+		encoded := string(appendContext(nil, open))
+		context, ok := contexts[encoded]
+		if !ok {
+			context = len(idx.contexts)
+			contexts[encoded] = context
+			idx.contexts = append(idx.contexts, open)
+		}
+
+		current = &indexEntry{key: key, context: context, start: d.offset, line: d.line, column: d.column}
+		depth = len(d.stack)
+	})
+
+	for {
+		_, done, err := d.step()
+		if current != nil && len(d.stack) < depth {
+			_, _, current.end = d.position()
+			idx.add(*current)
+			current = nil
+		}
+
+		if done {
+			return idx, err
+		}
+	}
+}
+
+func (idx *Index) add(e indexEntry) {
+	if _, ok := idx.keys[e.key]; ok {
+		return
+	}
+
+	idx.keys[e.key] = len(idx.entries)
+	idx.entries = append(idx.entries, e)
+}
+
+// Len returns the number of indexed elements.
+func (idx *Index) Len() int {
+	return len(idx.entries)
+}
+
+// Range returns the byte range of the element indexed with the passed key,
+// the end offset being excluded.
+func (idx *Index) Range(key string) (start int64, end int64, ok bool) {
+	i, ok := idx.keys[key]
+	if !ok {
+		return 0, 0, false
+	}
+
+	return idx.entries[i].start, idx.entries[i].end, true
+}
+
+// Decode parses the element indexed with the passed key, reading it from
+// r which must give access to the indexed document. The decoder is set up
+// by the passed function and Run as for a decoder returned by
+// ResumeDecoder: the tag callbacks of the enclosing elements are called
+// first, so that handlers see the same paths as when parsing the whole
+// document, and reported positions are positions in the document.
+func (idx *Index) Decode(r io.ReaderAt, key string, setup func(*Decoder)) error {
+	i, ok := idx.keys[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+
+	e := idx.entries[i]
+	var head [headSize]byte
+	n, err := r.ReadAt(head[:], 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	bom, err := offsetBase(head[:n])
+	if err != nil {
+		return err
+	}
+
+	open := idx.contexts[e.context]
+	var closing bytes.Buffer
+	for i := len(open) - 1; i >= 0; i-- {
+		closing.WriteString("</")
+		closing.WriteString(qualifiedName(frames(open[:i+1]), open[i].Name))
+		closing.WriteByte('>')
+	}
+
+	section := io.NewSectionReader(r, bom+e.start, e.end-e.start)
+	cp := Checkpoint{Offset: e.start, Line: e.line, Column: e.column, Stack: open}
+	d, err := resumeDecoder(io.MultiReader(section, &closing), cp)
+	if err != nil {
+		return err
+	}
+
+	setup(d)
+	return d.Run()
+}
+
+const indexMagic = "exml-index\x01"
+
+// WriteTo writes the index to w in a compact binary format which can be
+// read back with ReadIndex.
+func (idx *Index) WriteTo(w io.Writer) (int64, error) {
+	b := []byte(indexMagic)
+	b = binary.AppendUvarint(b, uint64(len(idx.contexts)))
+	for _, open := range idx.contexts {
+		b = appendContext(b, open)
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(idx.entries)))
+	var start int64
+	var line int
+	for _, e := range idx.entries {
+		b = appendString(b, e.key)
+		b = binary.AppendUvarint(b, uint64(e.context))
+		b = binary.AppendUvarint(b, uint64(e.start-start))
+		b = binary.AppendUvarint(b, uint64(e.end-e.start))
+		b = binary.AppendUvarint(b, uint64(e.line-line))
+		b = binary.AppendUvarint(b, uint64(e.column))
+		start, line = e.start, e.line
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+func appendContext(b []byte, open []xml.StartElement) []byte {
+	b = binary.AppendUvarint(b, uint64(len(open)))
+	for _, t := range open {
+		b = appendString(b, t.Name.Space)
+		b = appendString(b, t.Name.Local)
+		b = binary.AppendUvarint(b, uint64(len(t.Attr)))
+		for _, attr := range t.Attr {
+			b = appendString(b, attr.Name.Space)
+			b = appendString(b, attr.Name.Local)
+			b = appendString(b, attr.Value)
+		}
+	}
+	return b
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// ReadIndex reads an index written by Index.WriteTo.
+func ReadIndex(r io.Reader) (*Index, error) {
+	ir := &indexReader{r: bufio.NewReader(r)}
+	if ir.string(uint64(len(indexMagic))) != indexMagic {
+		return nil, ir.fail(errors.New("exml: not an index"))
+	}
+
+	idx := &Index{keys: map[string]int{}}
+	idx.contexts = make([][]xml.StartElement, ir.count())
+	for i := range idx.contexts {
+		open := make([]xml.StartElement, ir.count())
+		for j := range open {
+			open[j].Name = xml.Name{Space: ir.str(), Local: ir.str()}
+			open[j].Attr = make([]xml.Attr, ir.count())
+			for k := range open[j].Attr {
+				open[j].Attr[k] = xml.Attr{Name: xml.Name{Space: ir.str(), Local: ir.str()}, Value: ir.str()}
+			}
+		}
+		idx.contexts[i] = open
+	}
+
+	n := ir.uvarint()
+	var start int64
+	var line int
+	for range n {
+		e := indexEntry{key: ir.str(), context: int(ir.uvarint())}
+		e.start = start + int64(ir.uvarint())
+		e.end = e.start + int64(ir.uvarint())
+		e.line = line + int(ir.uvarint())
+		e.column = int(ir.uvarint())
+		start, line = e.start, e.line
+
+		if ir.err == nil && e.context >= len(idx.contexts) {
+			ir.err = errors.New("exml: corrupted index")
+		}
+		if ir.err != nil {
+			return nil, ir.err
+		}
+
+		idx.add(e)
+	}
+
+	return idx, ir.err
+}
+
+// An indexReader decodes the binary format of an index, the first error
+// being sticky.
+type indexReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (ir *indexReader) fail(err error) error {
+	if ir.err != nil {
+		return ir.err
+	}
+	return err
+}
+
+func (ir *indexReader) uvarint() uint64 {
+	if ir.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadUvarint(ir.r)
+	if err != nil {
+		ir.err = io.ErrUnexpectedEOF
+	}
+	return v
+}
+
+// count reads the size of a list of elements or attributes.
+func (ir *indexReader) count() int {
+	n := ir.uvarint()
+	if n > 1<<24 && ir.err == nil {
+		ir.err = errors.New("exml: corrupted index")
+	}
+	if ir.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (ir *indexReader) str() string {
+	return ir.string(ir.uvarint())
+}
+
+func (ir *indexReader) string(n uint64) string {
+	if ir.err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	if _, err := io.CopyN(&b, ir.r, int64(n)); err != nil {
+		ir.err = io.ErrUnexpectedEOF
+	}
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package exml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+func catalog(n int) string {
+	var b strings.Builder
+	b.WriteString("\ufeff<?xml version=\"1.0\"?>\n<c:catalog xmlns:c=\"urn:catalog\" currency=\"EUR\">\n  <c:products>\n")
+	for i := range n {
+		fmt.Fprintf(&b, "    <c:product sku=\"P%03d\"><c:name>Product %d</c:name><c:price>%d.99</c:price></c:product>\n", i, i, i)
+	}
+	b.WriteString("    <c:product><c:name>Unkeyed</c:name></c:product>\n    <c:product sku=\"P001\"/>\n  </c:products>\n</c:catalog>\n")
+	return b.String()
+}
+
+type indexedProduct struct {
+	currency string
+	sku      string
+	name     string
+	price    float64
+	path     string
+}
+
+func setupProduct(p *indexedProduct) func(*Decoder) {
+	return func(d *Decoder) {
+		d.On("catalog", func(attrs Attrs) {
+			p.currency = attrs.GetString("currency", "")
+			d.On("products/product", func(attrs Attrs) {
+				p.sku = attrs.GetString("sku", "")
+				p.path = d.path()
+				d.OnTextOf("name", Assign(&p.name))
+				d.OnTextOf("price", AssignFloat(&p.price, 64, -1))
+			})
+		})
+	}
+}
+
+func (s *EXMLSuite) Test_Index(c *check.C) {
+	data := catalog(100)
+	idx, err := BuildIndex(strings.NewReader(data), "catalog/products/product", "@sku")
+	c.Assert(err, check.IsNil)
+	c.Assert(idx.Len(), check.Equals, 100)
+
+	start, end, ok := idx.Range("P042")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(data[start+3:end+3], check.Equals, `<c:product sku="P042"><c:name>Product 42</c:name><c:price>42.99</c:price></c:product>`)
+
+	var buf bytes.Buffer
+	n, err := idx.WriteTo(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, int64(buf.Len()))
+
+	idx, err = ReadIndex(&buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(idx.Len(), check.Equals, 100)
+
+	r := strings.NewReader(data)
+	for _, i := range []int{0, 1, 42, 99} {
+		p := &indexedProduct{}
+		c.Assert(idx.Decode(r, fmt.Sprintf("P%03d", i), setupProduct(p)), check.IsNil)
+		c.Assert(*p, check.Equals, indexedProduct{
+			currency: "EUR",
+			sku:      fmt.Sprintf("P%03d", i),
+			name:     fmt.Sprintf("Product %d", i),
+			price:    float64(i) + 0.99,
+			path:     "catalog/products/product",
+		})
+	}
+
+	err = idx.Decode(r, "P100", setupProduct(&indexedProduct{}))
+	c.Assert(err, check.Equals, ErrKeyNotFound)
+}
+
+func (s *EXMLSuite) Test_IndexPositions(c *check.C) {
+	data := catalog(10)
+	idx, err := BuildIndex(strings.NewReader(data), "product", "sku")
+	c.Assert(err, check.IsNil)
+
+	err = idx.Decode(strings.NewReader(data), "P007", func(d *Decoder) {
+		d.OnTextOfE("product/price", func(text CharData) error {
+			return errCallback
+		})
+	})
+
+	var cbErr *CallbackError
+	c.Assert(errors.As(err, &cbErr), check.Equals, true)
+	c.Assert(cbErr.Path, check.Equals, "catalog/products/product/price")
+	c.Assert(cbErr.Line, check.Equals, 11)
+	offset := strings.Index(data, "</c:price></c:product>\n    <c:product sku=\"P008\"")
+	c.Assert(cbErr.Offset, check.Equals, int64(offset-3))
+}
+
+func (s *EXMLSuite) Test_ReadIndexErrors(c *check.C) {
+	_, err := ReadIndex(strings.NewReader("not an index"))
+	c.Assert(err, check.NotNil)
+
+	idx, err := BuildIndex(strings.NewReader(catalog(3)), "product", "sku")
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	idx.WriteTo(&buf)
+
+	_, err = ReadIndex(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	c.Assert(err, check.NotNil)
+}
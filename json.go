@@ -0,0 +1,492 @@
+package exml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A JSONConvention tells how ToJSON maps elements to JSON values.
+type JSONConvention int
+
+const (
+	// AttrTextConvention writes attributes as "@name" members and the
+	// text of elements with attributes or children as a "#text" member.
+	// Elements with neither are written as their text, or null when they
+	// are empty.
+	AttrTextConvention JSONConvention = iota
+
+	// BadgerFishConvention writes every element as an object, attributes
+	// as "@name" members and the text as a "$" member.
+	BadgerFishConvention
+
+	// ParkerConvention drops attributes and the text of elements with
+	// children, and writes elements without children as their text, or
+	// null when they are empty.
+	ParkerConvention
+)
+
+// A JSONType is the JSON type a text value is coerced to.
+type JSONType int
+
+const (
+	JSONString JSONType = iota
+	JSONNumber
+	JSONBool
+)
+
+// JSONOptions configure ToJSON. Paths are slash separated element names,
+// attributes being designated by an "@name" last step. A path matches the
+// elements or attributes whose path from the root of the document ends
+// with it, so that "price" matches every price element and
+// "product/@id" the id attribute of every product element.
+type JSONOptions struct {
+	Convention JSONConvention
+
+	// Arrays lists the paths of the elements which are always written
+	// in arrays, even when they occur once. Siblings with the same name
+	// are written in a single array anyway, which requires keeping the
+	// children of an element in memory until it ends. Hinted elements are
+	// instead written as soon as they are read, along with their
+	// ancestors, which are written in arrays as well so that their
+	// siblings with the same name can join them. An element writes a
+	// single array this way: until it ends, its children with another
+	// name are kept in memory, hinted or not.
+	Arrays []string
+
+	// Types maps paths to the type their text is coerced to, the text
+	// being written as a string when it can't be coerced.
+	Types map[string]JSONType
+
+	// Records, when set, switches to NDJSON output: the elements matched
+	// by the path, registered like with On, are each written on a line
+	// instead of the whole document being written as a single object.
+	Records string
+}
+
+// ToJSON converts the XML document read from r to JSON written to w,
+// following the passed options. Element and attribute names are written
+// without their namespace prefix, namespace declarations are left out and
+// text is trimmed like for text callbacks. Without the Records option,
+// the output is an object with a single member named after the root
+// element.
+func ToJSON(r io.Reader, w io.Writer, opts JSONOptions) error {
+	dst := &errWriter{w: w}
+	c := &jsonConverter{
+		d:      NewDecoder(r),
+		opts:   opts,
+		out:    bufio.NewWriter(dst),
+		arrays: byLength(opts.Arrays),
+		types:  byLength(keys(opts.Types)),
+	}
+	c.d.recordTokens(nil)
+	if opts.Records != "" {
+		c.d.On(opts.Records, func(Attrs) {
+			c.matched = len(c.open) == 0
+		})
+	}
+
+	for {
+		if dst.err != nil {
+			return dst.err
+		}
+
+		token, done, err := c.d.step()
+		if done {
+			if ferr := c.out.Flush(); err == nil {
+				err = ferr
+			}
+			return err
+		}
+
+		c.handle(token)
+	}
+}
+
+type jsonConverter struct {
+	d       *Decoder
+	opts    JSONOptions
+	out     *bufio.Writer
+	arrays  []string
+	types   []string
+	matched bool
+	open    []*jsonElement
+	free    []*bytes.Buffer
+}
+
+// A jsonWriter is where the value of an element is written, the output of
+// the converter or the buffer of an element kept in memory.
+type jsonWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// A jsonElement is an element being converted. The value of an element is
+// written to its parent's writer when it is streamed, and to a buffer held
+// by its parent until the parent ends otherwise.
+type jsonElement struct {
+	key      string
+	path     string
+	attrs    []xml.Attr
+	text     []byte
+	w        jsonWriter
+	buf      *bytes.Buffer
+	hinted   bool
+	streamed bool
+	opened   bool
+	members  int
+	array    string
+	held     []*jsonMember
+}
+
+// A jsonMember is a member held by an element until it ends, with the
+// values of the children written in it.
+type jsonMember struct {
+	key    string
+	array  bool
+	values []*bytes.Buffer
+}
+
+// handle converts the token which was just dispatched.
+func (c *jsonConverter) handle(token xml.Token) {
+	switch t := token.(type) {
+	case xml.StartElement:
+		switch {
+		case len(c.open) > 0:
+			c.start(t)
+		case c.matched || (c.opts.Records == "" && len(c.d.stack) == 1):
+			c.matched = false
+			c.begin(t)
+		}
+
+	case xml.EndElement:
+		if len(c.open) > 0 {
+			c.end()
+		}
+
+	case xml.CharData:
+		if len(c.open) > 0 {
+			e := c.open[len(c.open)-1]
+			e.text = append(e.text, t...)
+		}
+	}
+}
+
+// begin starts the conversion of a record, or of the root element.
+func (c *jsonConverter) begin(t xml.StartElement) {
+	if c.opts.Records == "" {
+		c.out.WriteByte('{')
+		writeJSONString(c.out, t.Name.Local)
+		c.out.WriteByte(':')
+	}
+
+	c.open = append(c.open, &jsonElement{key: t.Name.Local, path: c.d.path(), attrs: t.Attr, w: c.out, streamed: true})
+}
+
+// start starts the conversion of a child element.
+func (c *jsonConverter) start(t xml.StartElement) {
+	parent := c.open[len(c.open)-1]
+	e := &jsonElement{key: t.Name.Local, path: c.d.path(), attrs: t.Attr}
+	e.hinted = matchPath(c.arrays, e.path) != ""
+	if e.hinted {
+		c.commit()
+	}
+
+	c.openObject(parent)
+
+	switch {
+	case parent.array == e.key:
+		parent.w.WriteByte(',')
+		e.w, e.streamed = parent.w, true
+	case e.hinted && c.openArray(parent, e.key):
+		e.w, e.streamed = parent.w, true
+	default:
+		e.buf = c.buffer()
+		e.w = e.buf
+	}
+
+	c.open = append(c.open, e)
+}
+
+// end finishes the conversion of the innermost element.
+func (c *jsonConverter) end() {
+	e := c.open[len(c.open)-1]
+	c.open = c.open[:len(c.open)-1]
+	c.closeMembers(e)
+
+	text := bytes.TrimSpace(e.text)
+	switch {
+	case e.opened:
+	case c.opts.Convention == ParkerConvention || (c.opts.Convention == AttrTextConvention && !hasAttrs(e.attrs)):
+		if len(text) == 0 {
+			e.w.WriteString("null")
+		} else {
+			c.value(e.w, view(text), e.path)
+		}
+		c.done(e)
+		return
+	default:
+		c.openObject(e)
+	}
+
+	if len(text) > 0 && c.opts.Convention != ParkerConvention {
+		if c.opts.Convention == BadgerFishConvention {
+			c.member(e, "$")
+		} else {
+			c.member(e, "#text")
+		}
+		c.value(e.w, view(text), e.path)
+	}
+	e.w.WriteByte('}')
+	c.done(e)
+}
+
+// done hands over the value of a converted element to its parent.
+func (c *jsonConverter) done(e *jsonElement) {
+	if len(c.open) > 0 {
+		if !e.streamed {
+			c.open[len(c.open)-1].hold(e)
+		}
+		return
+	}
+
+	if c.opts.Records == "" {
+		c.out.WriteByte('}')
+	}
+	c.out.WriteByte('\n')
+}
+
+// commit streams the elements of the current branch which are kept in
+// memory, so that the branch is written as soon as it is read. Each of them
+// opens an array in its parent, which its later siblings with the same
+// name join. Committing stops at the first element whose parent can't
+// open an array for it, the rest of the branch being kept in memory.
+func (c *jsonConverter) commit() {
+	for i := 1; i < len(c.open); i++ {
+		parent, e := c.open[i-1], c.open[i]
+		if e.streamed {
+			continue
+		}
+		if !c.openArray(parent, e.key) {
+			return
+		}
+
+		c.writeBuffer(parent.w, e.buf)
+		e.buf = nil
+		e.w, e.streamed = parent.w, true
+	}
+}
+
+// openArray opens the array of the children named key of a streamed
+// element, unless the element already has an array or holds such
+// children, since a key must occur once in an object.
+func (c *jsonConverter) openArray(e *jsonElement, key string) bool {
+	if !e.streamed || e.array != "" || slices.ContainsFunc(e.held, func(m *jsonMember) bool {
+		return m.key == key
+	}) {
+		return false
+	}
+
+	c.member(e, key)
+	e.w.WriteByte('[')
+	e.array = key
+	return true
+}
+
+// openObject writes the start of the object of an element along with its
+// attributes, unless already done.
+func (c *jsonConverter) openObject(e *jsonElement) {
+	if e.opened {
+		return
+	}
+
+	e.opened = true
+	e.w.WriteByte('{')
+	if c.opts.Convention == ParkerConvention {
+		return
+	}
+
+	for _, attr := range e.attrs {
+		if isNamespaceDecl(attr) {
+			continue
+		}
+		c.member(e, "@"+attr.Name.Local)
+		c.value(e.w, attr.Value, e.path+"/@"+attr.Name.Local)
+	}
+}
+
+// closeMembers closes the array of an element and writes the members it
+// held, the values of the children with the same name being grouped.
+func (c *jsonConverter) closeMembers(e *jsonElement) {
+	if e.array != "" {
+		e.w.WriteByte(']')
+		e.array = ""
+	}
+
+	for _, m := range e.held {
+		c.member(e, m.key)
+		array := m.array || len(m.values) > 1
+		if array {
+			e.w.WriteByte('[')
+		}
+		for i, b := range m.values {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			c.writeBuffer(e.w, b)
+		}
+		if array {
+			e.w.WriteByte(']')
+		}
+	}
+	e.held = nil
+}
+
+// hold keeps the value of a child which was not streamed until the element
+// ends.
+func (e *jsonElement) hold(child *jsonElement) {
+	for _, m := range e.held {
+		if m.key == child.key {
+			m.values = append(m.values, child.buf)
+			return
+		}
+	}
+	e.held = append(e.held, &jsonMember{key: child.key, array: child.hinted, values: []*bytes.Buffer{child.buf}})
+}
+
+// member writes the key of a new member of the object of an element.
+func (c *jsonConverter) member(e *jsonElement, key string) {
+	if e.members > 0 {
+		e.w.WriteByte(',')
+	}
+	e.members++
+	writeJSONString(e.w, key)
+	e.w.WriteByte(':')
+}
+
+// value writes a text value coerced to the type of its path.
+func (c *jsonConverter) value(w jsonWriter, s string, path string) {
+	switch c.opts.Types[matchPath(c.types, path)] {
+	case JSONNumber:
+		if n := strings.TrimSpace(s); isJSONNumber(n) {
+			w.WriteString(n)
+			return
+		}
+	case JSONBool:
+		if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+			w.WriteString(strconv.FormatBool(b))
+			return
+		}
+	}
+
+	writeJSONString(w, s)
+}
+
+func (c *jsonConverter) buffer() *bytes.Buffer {
+	if n := len(c.free); n > 0 {
+		b := c.free[n-1]
+		c.free = c.free[:n-1]
+		return b
+	}
+	return &bytes.Buffer{}
+}
+
+// writeBuffer writes and releases the buffer of an element.
+func (c *jsonConverter) writeBuffer(w jsonWriter, b *bytes.Buffer) {
+	w.Write(b.Bytes())
+	b.Reset()
+	c.free = append(c.free, b)
+}
+
+func hasAttrs(attrs []xml.Attr) bool {
+	return slices.ContainsFunc(attrs, func(attr xml.Attr) bool {
+		return !isNamespaceDecl(attr)
+	})
+}
+
+// matchPath returns the longest of the passed paths, sorted by decreasing
+// length, which matches the end of path, or an empty string.
+func matchPath(paths []string, path string) string {
+	for _, p := range paths {
+		if path == p || (strings.HasSuffix(path, p) && path[len(path)-len(p)-1] == '/') {
+			return p
+		}
+	}
+	return ""
+}
+
+func byLength(paths []string) []string {
+	paths = slices.Clone(paths)
+	slices.SortFunc(paths, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	return paths
+}
+
+func keys[V any](m map[string]V) []string {
+	k := make([]string, 0, len(m))
+	for p := range m {
+		k = append(k, p)
+	}
+	return k
+}
+
+func isJSONNumber(s string) bool {
+	return s != "" && (s[0] == '-' || (s[0] >= '0' && s[0] <= '9')) && json.Valid([]byte(s))
+}
+
+// writeJSONString writes s as a JSON string.
+func writeJSONString(w jsonWriter, s string) {
+	const hex = "0123456789abcdef"
+
+	w.WriteByte('"')
+	last := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' {
+			if c < utf8.RuneSelf {
+				i++
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r != '\u2028' && r != '\u2029' {
+				i += size
+				continue
+			}
+			w.WriteString(s[last:i])
+			w.WriteString(`\u202`)
+			w.WriteByte(hex[r&0xF])
+			i += size
+			last = i
+			continue
+		}
+
+		w.WriteString(s[last:i])
+		switch c {
+		case '"', '\\':
+			w.WriteByte('\\')
+			w.WriteByte(c)
+		case '\n':
+			w.WriteString(`\n`)
+		case '\r':
+			w.WriteString(`\r`)
+		case '\t':
+			w.WriteString(`\t`)
+		default:
+			w.WriteString(`\u00`)
+			w.WriteByte(hex[c>>4])
+			w.WriteByte(hex[c&0xF])
+		}
+		i++
+		last = i
+	}
+	w.WriteString(s[last:])
+	w.WriteByte('"')
+}
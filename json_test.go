@@ -0,0 +1,160 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const CONVERT = `<?xml version="1.0"?>
+<catalog xmlns:x="urn:x" name="spring">
+    <product id="1" x:sku="A-1">
+        <name>Widget</name>
+        <price currency="EUR">12.50</price>
+        <stock>7</stock>
+        <tag>new</tag>
+        <tag>sale</tag>
+        <active>true</active>
+        <note/>
+    </product>
+    <product id="2">
+        <name>Gadget "Pro"</name>
+        <price currency="USD">n/a</price>
+        <stock>0</stock>
+        <tag>old</tag>
+        <active>no</active>
+        Discontinued
+    </product>
+    <info>Two products</info>
+</catalog>`
+
+func convert(c *check.C, doc string, opts JSONOptions) string {
+	var out bytes.Buffer
+	c.Assert(ToJSON(strings.NewReader(doc), &out, opts), check.IsNil)
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		c.Assert(json.Valid([]byte(line)), check.Equals, true, check.Commentf(line))
+	}
+	return out.String()
+}
+
+func (s *EXMLSuite) Test_ToJSONAttrText(c *check.C) {
+	out := convert(c, CONVERT, JSONOptions{
+		Types: map[string]JSONType{"price": JSONNumber, "stock": JSONNumber, "active": JSONBool, "product/@id": JSONNumber},
+	})
+	c.Assert(out, check.Equals, `{"catalog":{"@name":"spring","product":[`+
+		`{"@id":1,"@sku":"A-1","name":"Widget","price":{"@currency":"EUR","#text":12.50},"stock":7,"tag":["new","sale"],"active":true,"note":null},`+
+		`{"@id":2,"name":"Gadget \"Pro\"","price":{"@currency":"USD","#text":"n/a"},"stock":0,"tag":"old","active":"no","#text":"Discontinued"}],`+
+		`"info":"Two products"}}`+"\n")
+}
+
+func (s *EXMLSuite) Test_ToJSONBadgerFish(c *check.C) {
+	out := convert(c, SIMPLE_CONVERT, JSONOptions{Convention: BadgerFishConvention})
+	c.Assert(out, check.Equals, `{"a":{"@x":"1","b":[{"$":"one"},{"@y":"2"}],"c":{"$":"three"},"$":"tail"}}`+"\n")
+}
+
+func (s *EXMLSuite) Test_ToJSONParker(c *check.C) {
+	out := convert(c, SIMPLE_CONVERT, JSONOptions{Convention: ParkerConvention})
+	c.Assert(out, check.Equals, `{"a":{"b":["one",null],"c":"three"}}`+"\n")
+}
+
+const SIMPLE_CONVERT = `<a x="1"><b>one</b><b y="2"/><c>three</c>tail</a>`
+
+func (s *EXMLSuite) Test_ToJSONArrays(c *check.C) {
+	out := convert(c, CONVERT, JSONOptions{
+		Convention: ParkerConvention,
+		Arrays:     []string{"catalog/product", "tag", "info"},
+	})
+	c.Assert(out, check.Equals, `{"catalog":{"product":[`+
+		`{"tag":["new","sale"],"name":"Widget","price":"12.50","stock":"7","active":"true","note":null},`+
+		`{"tag":["old"],"name":"Gadget \"Pro\"","price":"n/a","stock":"0","active":"no"}],`+
+		`"info":["Two products"]}}`+"\n")
+}
+
+// assertJSON checks the decoded value of a converted document, which
+// catches members lost to duplicate keys.
+func assertJSON(c *check.C, out string, expected string) {
+	var obtained, wanted any
+	c.Assert(json.Unmarshal([]byte(out), &obtained), check.IsNil)
+	c.Assert(json.Unmarshal([]byte(expected), &wanted), check.IsNil)
+	c.Assert(obtained, check.DeepEquals, wanted, check.Commentf(out))
+}
+
+func (s *EXMLSuite) Test_ToJSONRepeatedAncestors(c *check.C) {
+	out := convert(c, CONVERT, JSONOptions{Convention: ParkerConvention, Arrays: []string{"tag"}})
+	assertJSON(c, out, `{"catalog":{"product":[`+
+		`{"name":"Widget","price":"12.50","stock":"7","tag":["new","sale"],"active":"true","note":null},`+
+		`{"name":"Gadget \"Pro\"","price":"n/a","stock":"0","tag":["old"],"active":"no"}],`+
+		`"info":"Two products"}}`)
+
+	// The first record has no hinted element and is kept in memory.
+	const doc = `<a><r><x>1</x></r><s/><r><t>2</t><t>3</t></r><s/><r><t>4</t></r></a>`
+	out = convert(c, doc, JSONOptions{Arrays: []string{"t"}})
+	assertJSON(c, out, `{"a":{"r":[{"x":"1"},{"t":["2","3"]},{"t":["4"]}],"s":[null,null]}}`)
+}
+
+func (s *EXMLSuite) Test_ToJSONNonAdjacentSiblings(c *check.C) {
+	out := convert(c, `<a><b>1</b><c/><b>2</b></a>`, JSONOptions{})
+	assertJSON(c, out, `{"a":{"b":["1","2"],"c":null}}`)
+
+	const doc = `<a><b>1</b><c>x</c><b>2</b><c y="3">z</c><b>4</b><d/></a>`
+	out = convert(c, doc, JSONOptions{Arrays: []string{"b"}})
+	assertJSON(c, out, `{"a":{"b":["1","2","4"],"c":["x",{"@y":"3","#text":"z"}],"d":null}}`)
+
+	out = convert(c, `<a><b>1</b><c>2</c><b>3</b><c>4</c></a>`, JSONOptions{Arrays: []string{"b", "c"}})
+	assertJSON(c, out, `{"a":{"b":["1","3"],"c":["2","4"]}}`)
+
+	out = convert(c, `<a><b>1</b><c><d>2</d></c><b>3</b><c><d>4</d></c></a>`, JSONOptions{Arrays: []string{"b", "d"}})
+	assertJSON(c, out, `{"a":{"b":["1","3"],"c":[{"d":["2"]},{"d":["4"]}]}}`)
+}
+
+func (s *EXMLSuite) Test_ToJSONStreaming(c *check.C) {
+	data := largeCatalog(1000)
+	var out bytes.Buffer
+	w := &watchWriter{w: &out}
+	err := ToJSON(bytes.NewReader(data), w, JSONOptions{Arrays: []string{"product"}})
+	c.Assert(err, check.IsNil)
+
+	// The products are written while the input is being read.
+	c.Assert(w.writes > 10, check.Equals, true)
+
+	v := map[string]map[string][]map[string]any{}
+	c.Assert(json.Unmarshal(out.Bytes(), &v), check.IsNil)
+	c.Assert(v["catalog"]["product"], check.HasLen, 1000)
+}
+
+// A watchWriter counts the writes to a writer.
+type watchWriter struct {
+	w      *bytes.Buffer
+	writes int
+}
+
+func (w *watchWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.w.Write(p)
+}
+
+func (s *EXMLSuite) Test_ToNDJSON(c *check.C) {
+	out := convert(c, CONVERT, JSONOptions{
+		Records: "catalog/product",
+		Types:   map[string]JSONType{"stock": JSONNumber},
+	})
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	c.Assert(lines, check.HasLen, 2)
+	c.Assert(lines[0], check.Equals, `{"@id":"1","@sku":"A-1","name":"Widget","price":{"@currency":"EUR","#text":"12.50"},"stock":7,"tag":["new","sale"],"active":"true","note":null}`)
+	c.Assert(lines[1], check.Equals, `{"@id":"2","name":"Gadget \"Pro\"","price":{"@currency":"USD","#text":"n/a"},"stock":0,"tag":"old","active":"no","#text":"Discontinued"}`)
+}
+
+func (s *EXMLSuite) Test_ToJSONErrors(c *check.C) {
+	var out bytes.Buffer
+	err := ToJSON(strings.NewReader(MALFORMED), &out, JSONOptions{})
+	c.Assert(err, check.NotNil)
+
+	err = ToJSON(bytes.NewReader(largeCatalog(1000)), failingWriter{}, JSONOptions{Records: "product"})
+	c.Assert(err, check.Equals, errCallback)
+
+	out.Reset()
+	c.Assert(ToJSON(strings.NewReader("<a>tab&#9;\"quote\\ \u2028é</a>"), &out, JSONOptions{}), check.IsNil)
+	c.Assert(out.String(), check.Equals, `{"a":"tab\t\"quote\\ \u2028é"}`+"\n")
+}
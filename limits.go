@@ -0,0 +1,158 @@
+package exml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Limits bounds the resources a Decoder may use while parsing, which is
+// needed when the input comes from an untrusted source. Zero values mean
+// unlimited.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of elements.
+	MaxDepth int
+
+	// MaxTextBytes is the maximum size of the text content accumulated
+	// for a single element between two tags. It is checked once the
+	// tokenizer has read a whole text token, so it doesn't bound the
+	// memory used for a huge text node: only MaxInputBytes does.
+	MaxTextBytes int
+
+	// MaxAttrs is the maximum number of attributes of an element. Like
+	// MaxAttrValueBytes, it is checked after the tokenizer has read the
+	// whole start tag, whose size is only bounded by MaxInputBytes.
+	MaxAttrs int
+
+	// MaxAttrValueBytes is the maximum size of a single attribute value,
+	// checked once the start tag holding it has been read. Set
+	// MaxInputBytes as well to bound the memory used by the tokenizer.
+	MaxAttrValueBytes int
+
+	// MaxTokens is the maximum number of tokens read from the input.
+	MaxTokens int64
+
+	// MaxInputBytes is the maximum number of bytes read from the input.
+	// It is enforced by the reader installed by NewDecoder, and checked
+	// after each token for decoders created with NewCustomDecoder, or with
+	// NewTokenDecoder when the token reader reports offsets.
+	MaxInputBytes int64
+}
+
+// A LimitError is returned by Run when the input exceeds one of the limits
+// set with Decoder.SetLimits. Limit is the name of the exceeded Limits
+// field and Max its value.
+type LimitError struct {
+	Limit  string
+	Max    int64
+	Line   int
+	Column int
+	Offset int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("exml: line %d, column %d: %s limit of %d exceeded", e.Line, e.Column, e.Limit, e.Max)
+}
+
+// SetLimits sets the resource limits enforced during parsing.
+func (d *Decoder) SetLimits(limits Limits) {
+	d.limits = limits
+	if d.input != nil {
+		d.input.max = limits.MaxInputBytes
+	}
+}
+
+func (d *Decoder) limitError(limit string, max int64) error {
+	return &LimitError{
+		Limit:  limit,
+		Max:    max,
+		Line:   d.line,
+		Column: d.column,
+		Offset: d.offset,
+	}
+}
+
+// checkToken enforces the limits which apply to every token.
+func (d *Decoder) checkToken() error {
+	l := &d.limits
+	d.tokens++
+	if l.MaxTokens > 0 && d.tokens > l.MaxTokens {
+		return d.limitError("MaxTokens", l.MaxTokens)
+	}
+
+	if l.MaxInputBytes > 0 {
+		if _, _, offset := d.position(); offset > l.MaxInputBytes {
+			return d.limitError("MaxInputBytes", l.MaxInputBytes)
+		}
+	}
+
+	return nil
+}
+
+// checkText enforces the text size limit before text content is extended
+// to the passed size.
+func (d *Decoder) checkText(size int) error {
+	l := &d.limits
+	if l.MaxTextBytes > 0 && size > l.MaxTextBytes {
+		return d.limitError("MaxTextBytes", int64(l.MaxTextBytes))
+	}
+
+	return nil
+}
+
+// checkElement enforces the depth and attribute limits before an element
+// is pushed on the passed number of open elements.
+func (d *Decoder) checkElement(depth int, attrs Attrs) error {
+	l := &d.limits
+	if l.MaxDepth > 0 && depth >= l.MaxDepth {
+		return d.limitError("MaxDepth", int64(l.MaxDepth))
+	}
+
+	if l.MaxAttrs > 0 && len(attrs) > l.MaxAttrs {
+		return d.limitError("MaxAttrs", int64(l.MaxAttrs))
+	}
+
+	if l.MaxAttrValueBytes > 0 {
+		for _, attr := range attrs {
+			if len(attr.Value) > l.MaxAttrValueBytes {
+				return d.limitError("MaxAttrValueBytes", int64(l.MaxAttrValueBytes))
+			}
+		}
+	}
+
+	return nil
+}
+
+var errInputLimit = errors.New("exml: input limit exceeded")
+
+// An inputReader counts the bytes read from the input and fails with
+// errInputLimit past the maximum input size, which prevents the underlying
+// xml.Decoder from buffering an oversized token.
+type inputReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (r *inputReader) Read(p []byte) (int, error) {
+	if r.max > 0 {
+		if r.n >= r.max {
+			// Probe the input to tell an oversized input from one which
+			// is exactly max bytes long.
+			var b [1]byte
+			n, err := r.r.Read(b[:])
+			if n > 0 {
+				return 0, errInputLimit
+			}
+			return 0, err
+		}
+
+		if int64(len(p)) > r.max-r.n {
+			p = p[:r.max-r.n]
+		}
+	}
+
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,89 @@
+package exml
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+func runLimitTest(c *check.C, data string, limits Limits) *LimitError {
+	decoder := NewDecoder(strings.NewReader(data))
+	decoder.SetLimits(limits)
+
+	reported := 0
+	decoder.OnError(func(err error) {
+		reported = reported + 1
+	})
+
+	err := decoder.Run()
+	if err == nil {
+		c.Assert(reported, check.Equals, 0)
+		return nil
+	}
+
+	c.Assert(reported, check.Equals, 1)
+	var limitErr *LimitError
+	c.Assert(errors.As(err, &limitErr), check.Equals, true, check.Commentf("%v", err))
+	return limitErr
+}
+
+func (s *EXMLSuite) Test_LimitsNotExceeded(c *check.C) {
+	c.Assert(runLimitTest(c, SIMPLE, Limits{
+		MaxDepth:          3,
+		MaxTextBytes:      16,
+		MaxAttrs:          2,
+		MaxAttrValueBytes: 13,
+		MaxTokens:         21,
+		MaxInputBytes:     int64(len(SIMPLE)),
+	}), check.IsNil)
+}
+
+func (s *EXMLSuite) Test_LimitMaxDepth(c *check.C) {
+	err := runLimitTest(c, SIMPLE, Limits{MaxDepth: 2})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Limit, check.Equals, "MaxDepth")
+	c.Assert(err.Max, check.Equals, int64(2))
+	c.Assert(err.Line, check.Equals, 7)
+	c.Assert(err.Column, check.Equals, 9)
+	c.Assert(err.Error(), check.Equals, "exml: line 7, column 9: MaxDepth limit of 2 exceeded")
+}
+
+func (s *EXMLSuite) Test_LimitMaxTextBytes(c *check.C) {
+	err := runLimitTest(c, MIXED, Limits{MaxTextBytes: 40})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Limit, check.Equals, "MaxTextBytes")
+	c.Assert(err.Line, check.Equals, 3)
+}
+
+func (s *EXMLSuite) Test_LimitMaxAttrs(c *check.C) {
+	err := runLimitTest(c, ATTRIBUTE, Limits{MaxAttrs: 9})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Limit, check.Equals, "MaxAttrs")
+}
+
+func (s *EXMLSuite) Test_LimitMaxAttrValueBytes(c *check.C) {
+	err := runLimitTest(c, SIMPLE, Limits{MaxAttrValueBytes: 12})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Limit, check.Equals, "MaxAttrValueBytes")
+	c.Assert(err.Line, check.Equals, 7)
+}
+
+func (s *EXMLSuite) Test_LimitMaxTokens(c *check.C) {
+	err := runLimitTest(c, SIMPLE, Limits{MaxTokens: 20})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Limit, check.Equals, "MaxTokens")
+}
+
+func (s *EXMLSuite) Test_LimitMaxInputBytes(c *check.C) {
+	huge := "<root>" + strings.Repeat("x", 1<<20) + "</root>"
+	err := runLimitTest(c, huge, Limits{MaxInputBytes: 1024})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Limit, check.Equals, "MaxInputBytes")
+	c.Assert(err.Max, check.Equals, int64(1024))
+
+	decoder := NewCustomDecoder(xml.NewDecoder(strings.NewReader(SIMPLE)))
+	decoder.SetLimits(Limits{MaxInputBytes: 64})
+	c.Assert(decoder.Run(), check.FitsTypeOf, &LimitError{})
+}
@@ -0,0 +1,369 @@
+package exml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// A RecordSetup registers the handlers of a record on the decoder passed
+// to it and returns a function delivering the results of the record, which
+// may be nil. See Decoder.Parallel.
+type RecordSetup func(record *Decoder) (deliver func())
+
+// Parallel dispatches the records found at the passed path on a pool of
+// workers goroutines, which helps when their callbacks are CPU heavy. The
+// tokens of each record are read and buffered by Run, then a worker calls
+// setup with a new decoder for the record and runs it. Registering handlers
+// on this decoder works as usual: as for a decoder returned by
+// ResumeDecoder, Run starts by calling the tag callbacks of the ancestors
+// of the record, so that paths are relative to the document root. The
+// callbacks run on the worker goroutine and must not touch the main
+// decoder.
+//
+// The function returned by setup is called on the goroutine which called
+// Run once the record was parsed, in document order when ordered is true,
+// in completion order otherwise. In document order, reading stops while
+// 4 records per worker are waiting for the delivery of an earlier one. The
+// errors of a record are handled by the main decoder with its error policy
+// when the record is delivered, and the limits of the main decoder apply
+// to the records as they are buffered. When panics are recovered, those
+// of setup and of the returned function are handled like callback panics.
+// Otherwise, a panic raised on a worker stops the parsing when its record
+// would have been delivered, and is raised again by Run once the workers
+// are done.
+//
+// A parallel path replaces the tag callback registered for the same path.
+// Records are delimited by counting tags, which requires well-formed
+// records in HTML mode.
+func (d *Decoder) Parallel(path string, workers int, ordered bool, setup RecordSetup) {
+	h := d.installHandlers(path)
+	h.parallel = &parallel{setup: setup, workers: max(workers, 1), ordered: ordered}
+}
+
+// maxAhead is the number of records per worker which may wait for the
+// delivery of an earlier record in document order.
+const maxAhead = 4
+
+type parallel struct {
+	setup   RecordSetup
+	workers int
+	ordered bool
+
+	jobs    chan *record
+	results chan *record
+	pending int
+	seq     int
+	next    int
+	done    map[int]*record
+}
+
+// A record holds the buffered tokens of a record along with their
+// positions, and the outcome of its parsing.
+type record struct {
+	p         *parallel
+	seq       int
+	path      string
+	ancestors []xml.StartElement
+	tokens    []xml.Token
+	positions []position
+	depth     int
+	text      int
+
+	deliver  func()
+	errs     []error
+	err      error
+	panicked any
+}
+
+type position struct {
+	line   int
+	column int
+	offset int64
+}
+
+// startRecord starts buffering the tokens of a record whose start element
+// was just pushed.
+func (d *Decoder) startRecord(p *parallel, t xml.StartElement) {
+	r := &record{p: p, path: d.path(), depth: 1}
+	for _, f := range d.stack[:len(d.stack)-1] {
+		r.ancestors = append(r.ancestors, xml.StartElement{Name: f.name, Attr: f.attr})
+	}
+
+	r.add(xml.CopyToken(t), d)
+	d.capture = r
+}
+
+func (r *record) add(token xml.Token, d *Decoder) {
+	r.tokens = append(r.tokens, token)
+	r.positions = append(r.positions, position{d.line, d.column, d.offset})
+}
+
+// captureToken buffers a token of the current record once the limits of
+// the decoder are checked. It returns false when the token is the end
+// element of the record, which must then be dispatched by the main decoder.
+func (d *Decoder) captureToken(token xml.Token) (bool, error) {
+	r := d.capture
+	switch t := token.(type) {
+	case xml.StartElement:
+		// The stack holds the ancestors of the record and the record.
+		if err := d.checkElement(len(d.stack)-1+r.depth, t.Attr); err != nil {
+			return true, d.fail(err)
+		}
+		r.depth++
+		r.text = 0
+	case xml.CharData:
+		if err := d.checkText(r.text + len(t)); err != nil {
+			return true, d.fail(err)
+		}
+		r.text += len(t)
+	case xml.EndElement:
+		r.depth--
+		r.text = 0
+	}
+
+	r.add(xml.CopyToken(token), d)
+
+	if r.depth > 0 {
+		return true, nil
+	}
+
+	d.capture = nil
+	return false, d.submit(r)
+}
+
+// submit hands a record over to the workers, delivering the records which
+// completed meanwhile.
+func (d *Decoder) submit(r *record) error {
+	p := r.p
+	if p.jobs == nil {
+		p.jobs = make(chan *record, p.workers)
+		p.results = make(chan *record, p.workers)
+		p.done = map[int]*record{}
+		for range p.workers {
+			go p.work(d, p.jobs, p.results)
+		}
+		d.parallels = append(d.parallels, p)
+	}
+
+	r.seq = p.seq
+	p.seq++
+	for {
+		// Sending on a nil channel blocks, leaving only the results.
+		jobs := p.jobs
+		if p.ordered && r.seq-p.next >= maxAhead*p.workers {
+			jobs = nil
+		}
+
+		select {
+		case jobs <- r:
+			p.pending++
+			return nil
+		case done := <-p.results:
+			if err := d.collect(done); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (p *parallel) work(d *Decoder, jobs <-chan *record, results chan<- *record) {
+	for r := range jobs {
+		p.run(d, r)
+		r.tokens = nil
+		results <- r
+	}
+}
+
+// run parses a record on a worker. A panic which is not recovered by the
+// decoder of the record is kept with the record, to be raised again on the
+// goroutine which called Run.
+func (p *parallel) run(d *Decoder, r *record) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.panicked = v
+		}
+	}()
+
+	rd := newRecordDecoder(r, d)
+	deliver, err := p.prepare(rd)
+	if err != nil {
+		r.err = r.callbackError(err)
+		r.errs = append(r.errs, r.err)
+		return
+	}
+
+	r.deliver = deliver
+	r.err = rd.Run()
+}
+
+// A workerPanic stops the parsing when a record whose worker panicked is
+// due, the panic being raised again by wait.
+type workerPanic struct {
+	value any
+}
+
+func (e *workerPanic) Error() string {
+	return fmt.Sprintf("exml: panic in a parallel record: %v", e.value)
+}
+
+// prepare calls setup with the decoder of a record, recovering its panics
+// when the decoder does.
+func (p *parallel) prepare(rd *Decoder) (deliver func(), err error) {
+	if rd.recoverPanics {
+		defer recoverPanic(&err)
+	}
+
+	return p.setup(rd), nil
+}
+
+// callbackError wraps an error raised by the setup or the delivery of a
+// record with its path and the position of its start tag.
+func (r *record) callbackError(err error) error {
+	pos := r.positions[0]
+	return &CallbackError{Path: r.path, Line: pos.line, Column: pos.column, Offset: pos.offset, Err: err}
+}
+
+// newRecordDecoder returns a decoder replaying the tokens of a record
+// inside its ancestors, configured like the main decoder.
+func newRecordDecoder(r *record, d *Decoder) *Decoder {
+	rd := NewCustomDecoder(nil)
+	rd.source = &recordReader{r: r}
+	rd.errorPolicy = d.errorPolicy
+	rd.recoverPanics = d.recoverPanics
+	rd.stripNSDecls = d.stripNSDecls
+	rd.html = d.html
+	rd.limits = d.limits
+	rd.errorCallback = func(err error) {
+		r.errs = append(r.errs, err)
+	}
+
+	rd.resume = r.ancestors
+	return rd
+}
+
+// collect delivers the completed records which are due. The returned error
+// means that parsing must stop.
+func (d *Decoder) collect(r *record) error {
+	p := r.p
+	p.pending--
+	if !p.ordered {
+		return d.deliver(r)
+	}
+
+	p.done[r.seq] = r
+	for {
+		r, ok := p.done[p.next]
+		if !ok {
+			return nil
+		}
+
+		delete(p.done, p.next)
+		p.next++
+		if err := d.deliver(r); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Decoder) deliver(r *record) error {
+	if r.panicked != nil {
+		return &workerPanic{value: r.panicked}
+	}
+
+	// The last error reported by a record stopped it.
+	errs := r.errs
+	if r.err != nil {
+		errs = errs[:len(errs)-1]
+	}
+
+	for _, err := range errs {
+		d.report(err)
+	}
+
+	if r.err != nil && d.errorPolicy == StopOnError {
+		return d.fail(r.err)
+	}
+
+	if r.err != nil {
+		d.report(r.err)
+	}
+
+	if r.deliver == nil {
+		return nil
+	}
+
+	if err := d.callDeliver(r.deliver); err != nil {
+		err = r.callbackError(err)
+		if d.errorPolicy == StopOnError {
+			return d.fail(err)
+		}
+		d.report(err)
+	}
+
+	return nil
+}
+
+// callDeliver calls the delivery function of a record, recovering its
+// panics when the decoder does.
+func (d *Decoder) callDeliver(deliver func()) (err error) {
+	if d.recoverPanics {
+		defer recoverPanic(&err)
+	}
+
+	deliver()
+	return nil
+}
+
+// wait delivers the pending records once Run is over and stops the
+// workers. The records are dropped when parsing stopped on an error, and a
+// panic raised on a worker is raised again once they are stopped.
+func (d *Decoder) wait(err error) error {
+	for _, p := range d.parallels {
+		close(p.jobs)
+		for p.pending > 0 {
+			r := <-p.results
+			if err != nil {
+				p.pending--
+				continue
+			}
+
+			err = d.collect(r)
+		}
+
+		p.jobs = nil
+		p.seq = 0
+		p.next = 0
+	}
+
+	d.parallels = nil
+	if wp, ok := err.(*workerPanic); ok {
+		panic(wp.value)
+	}
+	return err
+}
+
+// A recordReader replays the tokens of a record along with their positions.
+type recordReader struct {
+	r *record
+	i int
+}
+
+func (rr *recordReader) Token() (xml.Token, error) {
+	if rr.i >= len(rr.r.tokens) {
+		return nil, io.EOF
+	}
+
+	t := rr.r.tokens[rr.i]
+	rr.i++
+	return t, nil
+}
+
+func (rr *recordReader) InputPos() (int, int) {
+	p := rr.r.positions[min(rr.i, len(rr.r.positions)-1)]
+	return p.line, p.column
+}
+
+func (rr *recordReader) InputOffset() int64 {
+	return rr.r.positions[min(rr.i, len(rr.r.positions)-1)].offset
+}
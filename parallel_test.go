@@ -0,0 +1,248 @@
+package exml
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func records(n int) string {
+	var b strings.Builder
+	b.WriteString(`<dump xmlns="urn:dump"><meta>header</meta>`)
+	for i := range n {
+		fmt.Fprintf(&b, `<record id="%d"><name>Record %d</name><tags><tag>a</tag><tag>b%d</tag></tags></record>`, i, i, i)
+	}
+	b.WriteString(`<meta>footer</meta></dump>`)
+	return b.String()
+}
+
+type parallelRecord struct {
+	ID   string
+	Name string
+	Tags []string
+	Path string
+	Hash string
+}
+
+func setupRecord(record *Decoder, out *[]*parallelRecord) func() {
+	r := &parallelRecord{}
+	record.On("dump/record", func(attrs Attrs) {
+		r.ID = attrs.GetString("id", "")
+		r.Path = record.path()
+		record.OnTextOf("name", func(text CharData) {
+			r.Name = string(text)
+			r.Hash = fmt.Sprintf("%x", sha256.Sum256(text))
+		})
+		record.OnTextOf("tags/tag", Append(&r.Tags))
+	})
+
+	return func() {
+		*out = append(*out, r)
+	}
+}
+
+func (s *EXMLSuite) Test_ParallelOrdered(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(records(200)))
+
+	metas := []string{}
+	decoder.OnTextOf("dump/meta", Append(&metas))
+
+	out := []*parallelRecord{}
+	decoder.Parallel("dump/record", 4, true, func(record *Decoder) func() {
+		return setupRecord(record, &out)
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(metas, check.DeepEquals, []string{"header", "footer"})
+	c.Assert(out, check.HasLen, 200)
+	for i, r := range out {
+		c.Assert(r.ID, check.Equals, fmt.Sprint(i))
+		c.Assert(r.Name, check.Equals, fmt.Sprintf("Record %d", i))
+		c.Assert(r.Tags, check.DeepEquals, []string{"a", fmt.Sprintf("b%d", i)})
+		c.Assert(r.Path, check.Equals, "dump/record")
+	}
+}
+
+func (s *EXMLSuite) Test_ParallelUnordered(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(records(100)))
+
+	out := []*parallelRecord{}
+	decoder.Parallel("record", 3, false, func(record *Decoder) func() {
+		return setupRecord(record, &out)
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(out, check.HasLen, 100)
+
+	seen := map[string]bool{}
+	for _, r := range out {
+		seen[r.ID] = true
+	}
+	c.Assert(seen, check.HasLen, 100)
+}
+
+func (s *EXMLSuite) Test_ParallelErrors(c *check.C) {
+	setup := func(record *Decoder) func() {
+		record.OnE("dump/record", func(attrs Attrs) error {
+			if attrs.GetString("id", "") == "7" {
+				return errCallback
+			}
+			return nil
+		})
+		return nil
+	}
+
+	decoder := NewDecoder(strings.NewReader(records(50)))
+	decoder.Parallel("dump/record", 4, true, setup)
+	err := decoder.Run()
+	c.Assert(errors.Is(err, errCallback), check.Equals, true)
+
+	var cbErr *CallbackError
+	c.Assert(errors.As(err, &cbErr), check.Equals, true)
+	c.Assert(cbErr.Path, check.Equals, "dump/record")
+	c.Assert(cbErr.Offset, check.Equals, int64(strings.Index(records(50), `<record id="7"`)))
+
+	reported := 0
+	decoder = NewDecoder(strings.NewReader(records(50)))
+	decoder.SetErrorPolicy(ContinueOnError)
+	decoder.OnError(func(err error) {
+		reported++
+	})
+	decoder.Parallel("dump/record", 4, true, setup)
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(reported, check.Equals, 1)
+}
+
+func (s *EXMLSuite) Test_ParallelLimits(c *check.C) {
+	deep := "<dump><record>" + strings.Repeat("<a>", 50) + strings.Repeat("</a>", 50) + "</record></dump>"
+	long := "<dump><record><a>" + strings.Repeat("x", 1000) + "</a></record></dump>"
+	attrs := `<dump><record><a x="1" y="2" z="3"/></record></dump>`
+
+	for _, t := range []struct {
+		data   string
+		limits Limits
+		limit  string
+	}{
+		{deep, Limits{MaxDepth: 5}, "MaxDepth"},
+		{long, Limits{MaxTextBytes: 10}, "MaxTextBytes"},
+		{attrs, Limits{MaxAttrs: 2}, "MaxAttrs"},
+		{attrs, Limits{MaxAttrValueBytes: 1}, ""},
+	} {
+		decoder := NewDecoder(strings.NewReader(t.data))
+		decoder.SetLimits(t.limits)
+		decoder.Parallel("dump/record", 2, true, func(record *Decoder) func() {
+			return nil
+		})
+
+		err := decoder.Run()
+		if t.limit == "" {
+			c.Assert(err, check.IsNil)
+			continue
+		}
+
+		var limitErr *LimitError
+		c.Assert(errors.As(err, &limitErr), check.Equals, true, check.Commentf("%v", err))
+		c.Assert(limitErr.Limit, check.Equals, t.limit)
+	}
+}
+
+func (s *EXMLSuite) Test_ParallelOrderedBacklog(c *check.C) {
+	var started atomic.Int32
+	var ahead int32
+	decoder := NewDecoder(strings.NewReader(records(200)))
+	decoder.Parallel("dump/record", 4, true, func(record *Decoder) func() {
+		if started.Add(1) == 1 {
+			// The first record is slow, the next ones wait for it.
+			time.Sleep(100 * time.Millisecond)
+			ahead = started.Load()
+		}
+		return nil
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(started.Load(), check.Equals, int32(200))
+	c.Assert(ahead <= maxAhead*4, check.Equals, true, check.Commentf("%d records started", ahead))
+}
+
+func (s *EXMLSuite) Test_ParallelPanics(c *check.C) {
+	var calls atomic.Int32
+	setup := func(record *Decoder) func() {
+		if calls.Add(1) == 3 {
+			panic("setup")
+		}
+
+		r := &parallelRecord{}
+		record.On("dump/record", func(attrs Attrs) {
+			r.ID = attrs.GetString("id", "")
+		})
+		return func() {
+			if r.ID == "5" {
+				panic("deliver")
+			}
+		}
+	}
+
+	decoder := NewDecoder(strings.NewReader(records(10)))
+	decoder.RecoverPanics(true)
+	decoder.Parallel("dump/record", 1, true, setup)
+	err := decoder.Run()
+
+	var panicErr *PanicError
+	var cbErr *CallbackError
+	c.Assert(errors.As(err, &panicErr), check.Equals, true)
+	c.Assert(panicErr.Value, check.Equals, "setup")
+	c.Assert(errors.As(err, &cbErr), check.Equals, true)
+	c.Assert(cbErr.Path, check.Equals, "dump/record")
+	c.Assert(cbErr.Offset, check.Equals, int64(strings.Index(records(10), `<record id="2"`)))
+
+	calls.Store(0)
+	panics := []any{}
+	decoder = NewDecoder(strings.NewReader(records(10)))
+	decoder.RecoverPanics(true)
+	decoder.SetErrorPolicy(ContinueOnError)
+	decoder.OnError(func(err error) {
+		if errors.As(err, &panicErr) {
+			panics = append(panics, panicErr.Value)
+		}
+	})
+	decoder.Parallel("dump/record", 1, true, setup)
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(panics, check.DeepEquals, []any{"setup", "deliver"})
+}
+
+func (s *EXMLSuite) Test_ParallelUnrecoveredPanics(c *check.C) {
+	for _, ordered := range []bool{true, false} {
+		delivered := []string{}
+		decoder := NewDecoder(strings.NewReader(records(10)))
+		decoder.Parallel("dump/record", 4, ordered, func(record *Decoder) func() {
+			r := &parallelRecord{}
+			record.On("dump/record", func(attrs Attrs) {
+				r.ID = attrs.GetString("id", "")
+				if r.ID == "3" {
+					panic("boom")
+				}
+			})
+			return func() {
+				delivered = append(delivered, r.ID)
+			}
+		})
+
+		recovered := func() (v any) {
+			defer func() {
+				v = recover()
+			}()
+			decoder.Run()
+			return nil
+		}()
+
+		c.Assert(recovered, check.Equals, "boom")
+		if ordered {
+			c.Assert(delivered, check.DeepEquals, []string{"0", "1", "2"})
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package exml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// A streamReader is the byte reader the xml.Decoder created by NewDecoder
+// reads from. Since the xml.Decoder reads it byte by byte, nothing is read
+// ahead of the decoder position and parsing can be resumed from the exact
+// place where a decoder stopped. It can also serve a synthesized prelude
+// before the input.
+type streamReader struct {
+	prelude []byte
+	r       *bufio.Reader
+	n       int64
+	last    [2]byte // the last two bytes read
+}
+
+func newStreamReader(r io.Reader) *streamReader {
+	return &streamReader{r: bufio.NewReader(r)}
+}
+
+func (s *streamReader) ReadByte() (byte, error) {
+	if len(s.prelude) > 0 {
+		b := s.prelude[0]
+		s.prelude = s.prelude[1:]
+		s.last = [2]byte{s.last[1], b}
+		return b, nil
+	}
+
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.n++
+		s.last = [2]byte{s.last[1], b}
+	}
+	return b, err
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	if len(s.prelude) > 0 {
+		n := copy(p, s.prelude)
+		s.prelude = s.prelude[n:]
+		return n, nil
+	}
+
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	return n, err
+}
+
+// unreadByte gives back the last byte read from the input.
+func (s *streamReader) unreadByte() {
+	if s.r.UnreadByte() == nil {
+		s.n--
+	}
+}
+
+// prelude returns the start tags of the passed open elements, along with
+// their namespace declarations, so that a new xml.Decoder reading an input
+// from the middle of a document resolves the namespace prefixes and
+// accepts the end tags of these elements.
+func prelude(open []frame) []byte {
+	var b bytes.Buffer
+	for i, f := range open {
+		b.WriteByte('<')
+		b.WriteString(qualifiedName(open[:i+1], f.name))
+		for _, attr := range f.attr {
+			if !isNamespaceDecl(attr) {
+				continue
+			}
+
+			b.WriteByte(' ')
+			if attr.Name.Space != "" {
+				b.WriteString(attr.Name.Space)
+				b.WriteByte(':')
+			}
+			b.WriteString(attr.Name.Local)
+			b.WriteString(`="`)
+			xml.EscapeText(&b, []byte(attr.Value))
+			b.WriteByte('"')
+		}
+		b.WriteByte('>')
+	}
+
+	return b.Bytes()
+}
+
+// qualifiedName returns the name of an element as it appears in the
+// document, looking up the prefix bound to its namespace in the
+// declarations of the passed open elements, the innermost being the last.
+func qualifiedName(open []frame, name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		for _, attr := range open[i].attr {
+			if !isNamespaceDecl(attr) || attr.Value != name.Space {
+				continue
+			}
+
+			if attr.Name.Space == "" {
+				return name.Local
+			}
+			return attr.Name.Local + ":" + name.Local
+		}
+	}
+
+	// The prefix is unbound, or not translated in HTML mode.
+	return name.Space + ":" + name.Local
+}
+
+// prime replaces the underlying xml.Decoder with a new one, configured like
+// the current one, reading from r after the prelude of the passed open
+// elements. The start elements of the prelude are consumed without being
+// dispatched. The offset and position of the first byte of r in the whole
+// input are used to keep reporting absolute positions.
+func (d *Decoder) prime(r io.Reader, open []frame, offset int64, line int, column int) error {
+	pre := prelude(open)
+
+	var stream *streamReader
+	if s, ok := r.(*streamReader); ok {
+		stream = s
+		stream.prelude = pre
+		r = stream
+	} else {
+		r = io.MultiReader(bytes.NewReader(pre), r)
+	}
+
+	old := d.decoder
+	xd := xml.NewDecoder(r)
+	xd.Strict = old.Strict
+	xd.AutoClose = old.AutoClose
+	xd.Entity = old.Entity
+	xd.CharsetReader = old.CharsetReader
+	xd.DefaultSpace = old.DefaultSpace
+
+	d.decoder = xd
+	if !d.html {
+		d.source = xd
+	}
+
+	d.locate(len(pre), offset, line, column)
+
+	for range open {
+		if _, err := d.source.Token(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// locate sets the position of the first input byte following a prelude of
+// the passed size, the positions of the underlying xml.Decoder being
+// relative to the start of the prelude.
+func (d *Decoder) locate(prelude int, offset int64, line int, column int) {
+	d.base = offset - int64(prelude)
+	d.lineBase = line - 1
+	d.columnBase = column - prelude - 1
+}
+
+// A positioner is a token source which knows the position of its tokens
+// in the input, like an xml.Decoder.
+type positioner interface {
+	InputPos() (line int, column int)
+	InputOffset() int64
+}
+
+// position returns the current position of the decoder in the whole input.
+func (d *Decoder) position() (line int, column int, offset int64) {
+	if d.decoder == nil {
+		if p, ok := d.source.(positioner); ok {
+			line, column = p.InputPos()
+			return line, column, p.InputOffset()
+		}
+		return 0, 0, 0
+	}
+
+	line, column = d.decoder.InputPos()
+	if line == 1 {
+		column += d.columnBase
+	}
+
+	return line + d.lineBase, column, d.base + d.decoder.InputOffset()
+}
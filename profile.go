@@ -0,0 +1,261 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ValueType is the type inferred from a text or attribute value.
+type ValueType int
+
+const (
+	StringValue ValueType = iota
+	IntValue
+	FloatValue
+	BoolValue
+	DateValue
+)
+
+var valueTypeNames = [...]string{"string", "int", "float", "bool", "date"}
+
+func (t ValueType) String() string {
+	return valueTypeNames[t]
+}
+
+// MarshalText implements encoding.TextMarshaler, so that the type counts
+// of profiles are encoded as JSON objects keyed by type names.
+func (t ValueType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// A DocumentProfile describes the structure of a document.
+type DocumentProfile struct {
+	// Paths holds the distinct element paths, in the order of their first
+	// occurrence.
+	Paths []*PathProfile `json:"paths"`
+
+	// Elements holds the distinct element names, in the order of their
+	// first occurrence.
+	Elements []*ElementProfile `json:"elements"`
+}
+
+// A PathProfile describes the elements found at a path.
+type PathProfile struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+	Count int64  `json:"count"`
+
+	// Attrs holds the distinct attribute names of the elements, namespace
+	// declarations excluded, in the order of their first occurrence.
+	Attrs []*AttrProfile `json:"attrs"`
+
+	// Text describes the text of the elements, trimmed like for text
+	// callbacks, the elements without text being left out.
+	Text ValueProfile `json:"text"`
+}
+
+// An AttrProfile describes the values of an attribute.
+type AttrProfile struct {
+	Name string `json:"name"`
+	ValueProfile
+}
+
+// An ElementProfile describes the elements with a given name, whatever
+// their path.
+type ElementProfile struct {
+	Name     string `json:"name"`
+	Count    int64  `json:"count"`
+	MinDepth int    `json:"min_depth"`
+	MaxDepth int    `json:"max_depth"`
+}
+
+// A ValueProfile describes a set of text or attribute values.
+type ValueProfile struct {
+	Count       int64 `json:"count"`
+	MinLength   int   `json:"min_length"`
+	MaxLength   int   `json:"max_length"`
+	TotalLength int64 `json:"total_length"`
+
+	// Lengths is the distribution of the lengths in bytes of the values:
+	// Lengths[0] counts the empty values and Lengths[i] the values whose
+	// length is at least 2^(i-1) and less than 2^i.
+	Lengths []int64 `json:"lengths"`
+
+	// Types counts the values by inferred type.
+	Types map[ValueType]int64 `json:"types"`
+}
+
+func (v *ValueProfile) add(value string) {
+	n := len(value)
+	if v.Count == 0 || n < v.MinLength {
+		v.MinLength = n
+	}
+	v.MaxLength = max(v.MaxLength, n)
+	v.Count++
+	v.TotalLength += int64(n)
+
+	bucket := bits.Len(uint(n))
+	for len(v.Lengths) <= bucket {
+		v.Lengths = append(v.Lengths, 0)
+	}
+	v.Lengths[bucket]++
+
+	if v.Types == nil {
+		v.Types = map[ValueType]int64{}
+	}
+	v.Types[InferType(value)]++
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// InferType returns the type of a value: an integer or a floating point
+// number in decimal notation, true or false in any case, an RFC 3339 or
+// RFC 1123 date, or a string otherwise.
+func InferType(value string) ValueType {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return IntValue
+	}
+
+	if _, err := strconv.ParseFloat(value, 64); err == nil && !strings.ContainsAny(value, "xXpPiInN_") {
+		return FloatValue
+	}
+
+	if strings.EqualFold(value, "true") || strings.EqualFold(value, "false") {
+		return BoolValue
+	}
+
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return DateValue
+		}
+	}
+
+	return StringValue
+}
+
+// Profile parses the document read from r and describes its structure:
+// the distinct element paths with their attributes and text values, and
+// the distinct element names with the depths at which they occur. Only
+// the profile is kept in memory. The returned error is the one which
+// stopped the parsing, the profile then describing the part of the
+// document which was parsed.
+func Profile(r io.Reader) (*DocumentProfile, error) {
+	p := &profiler{
+		d:        NewDecoder(r),
+		profile:  &DocumentProfile{},
+		paths:    map[string]*PathProfile{},
+		elements: map[string]*ElementProfile{},
+	}
+	p.d.recordTokens(nil)
+
+	for {
+		token, done, err := p.d.step()
+		if done {
+			return p.profile, err
+		}
+
+		p.handle(token)
+	}
+}
+
+type profiler struct {
+	d        *Decoder
+	profile  *DocumentProfile
+	paths    map[string]*PathProfile
+	elements map[string]*ElementProfile
+	open     []profiledElement
+}
+
+// A profiledElement is an open element along with its text.
+type profiledElement struct {
+	path *PathProfile
+	text []byte
+}
+
+// handle profiles the token which was just dispatched.
+func (p *profiler) handle(token xml.Token) {
+	switch t := token.(type) {
+	case xml.StartElement:
+		p.start(t)
+
+	case xml.CharData:
+		if n := len(p.open); n > 0 {
+			p.open[n-1].text = append(p.open[n-1].text, t...)
+		}
+
+	case xml.EndElement:
+		n := len(p.open) - 1
+		e := p.open[n]
+		p.open = p.open[:n]
+		if text := bytes.TrimSpace(e.text); len(text) > 0 {
+			e.path.Text.add(view(text))
+		}
+	}
+}
+
+func (p *profiler) start(t xml.StartElement) {
+	name := t.Name.Local
+	path := name
+	if n := len(p.open); n > 0 {
+		path = p.open[n-1].path.Path + "/" + name
+	}
+	depth := len(p.open) + 1
+
+	pp := p.paths[path]
+	if pp == nil {
+		pp = &PathProfile{Path: path, Depth: depth}
+		p.paths[path] = pp
+		p.profile.Paths = append(p.profile.Paths, pp)
+	}
+	pp.Count++
+
+	for _, attr := range t.Attr {
+		if !isNamespaceDecl(attr) {
+			pp.attr(attr.Name.Local).add(attr.Value)
+		}
+	}
+
+	e := p.elements[name]
+	if e == nil {
+		e = &ElementProfile{Name: name, MinDepth: depth}
+		p.elements[name] = e
+		p.profile.Elements = append(p.profile.Elements, e)
+	}
+	e.Count++
+	e.MinDepth = min(e.MinDepth, depth)
+	e.MaxDepth = max(e.MaxDepth, depth)
+
+	// The text buffers of the closed elements are reused.
+	if n := len(p.open); n < cap(p.open) {
+		p.open = p.open[:n+1]
+		p.open[n].path = pp
+		p.open[n].text = p.open[n].text[:0]
+	} else {
+		p.open = append(p.open, profiledElement{path: pp})
+	}
+}
+
+// attr returns the profile of an attribute, added when missing.
+func (pp *PathProfile) attr(name string) *AttrProfile {
+	for _, a := range pp.Attrs {
+		if a.Name == name {
+			return a
+		}
+	}
+
+	a := &AttrProfile{Name: name}
+	pp.Attrs = append(pp.Attrs, a)
+	return a
+}
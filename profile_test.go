@@ -0,0 +1,88 @@
+package exml
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const PROFILE = `<?xml version="1.0"?>
+<feed xmlns:x="urn:x" version="2">
+    <entry id="1" x:lang="en">
+        <title>Hello</title>
+        <price>12.5</price>
+        <published>2024-03-01</published>
+        <entry id="nested"><flag>true</flag></entry>
+    </entry>
+    <entry id="2">
+        <title>A much longer title</title>
+        <price>7</price>
+        <published>2024-03-02T10:00:00Z</published>
+        <title/>
+    </entry>
+</feed>`
+
+func (s *EXMLSuite) Test_Profile(c *check.C) {
+	profile, err := Profile(strings.NewReader(PROFILE))
+	c.Assert(err, check.IsNil)
+
+	paths := []string{}
+	for _, p := range profile.Paths {
+		paths = append(paths, p.Path)
+	}
+	c.Assert(paths, check.DeepEquals, []string{
+		"feed", "feed/entry", "feed/entry/title", "feed/entry/price", "feed/entry/published",
+		"feed/entry/entry", "feed/entry/entry/flag",
+	})
+
+	entry := profile.Paths[1]
+	c.Assert(entry.Depth, check.Equals, 2)
+	c.Assert(entry.Count, check.Equals, int64(2))
+	c.Assert(entry.Attrs, check.HasLen, 2)
+	c.Assert(entry.Attrs[0].Name, check.Equals, "id")
+	c.Assert(entry.Attrs[0].Types, check.DeepEquals, map[ValueType]int64{IntValue: 2})
+	c.Assert(entry.Attrs[1].Name, check.Equals, "lang")
+	c.Assert(entry.Attrs[1].Count, check.Equals, int64(1))
+	c.Assert(entry.Text.Count, check.Equals, int64(0))
+
+	title := profile.Paths[2]
+	c.Assert(title.Count, check.Equals, int64(3))
+	c.Assert(title.Text, check.DeepEquals, ValueProfile{
+		Count:       2,
+		MinLength:   5,
+		MaxLength:   19,
+		TotalLength: 24,
+		Lengths:     []int64{0, 0, 0, 1, 0, 1},
+		Types:       map[ValueType]int64{StringValue: 2},
+	})
+
+	c.Assert(profile.Paths[3].Text.Types, check.DeepEquals, map[ValueType]int64{FloatValue: 1, IntValue: 1})
+	c.Assert(profile.Paths[4].Text.Types, check.DeepEquals, map[ValueType]int64{DateValue: 2})
+	c.Assert(profile.Paths[6].Text.Types, check.DeepEquals, map[ValueType]int64{BoolValue: 1})
+
+	c.Assert(profile.Elements[1], check.DeepEquals, &ElementProfile{Name: "entry", Count: 3, MinDepth: 2, MaxDepth: 3})
+
+	b, err := json.Marshal(profile.Paths[3].Text.Types)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(b), check.Equals, `{"float":1,"int":1}`)
+}
+
+func (s *EXMLSuite) Test_InferType(c *check.C) {
+	for value, expected := range map[string]ValueType{
+		"42": IntValue, "-7": IntValue, "3.14": FloatValue, "1e-3": FloatValue,
+		"0x1p-2": StringValue, "NaN": StringValue, "Inf": StringValue, "1_000": StringValue,
+		"TRUE": BoolValue, "false": BoolValue, "yes": StringValue,
+		"2024-03-01": DateValue, "2024-03-01T10:00:00+02:00": DateValue, "2024-03-01 10:00:00": DateValue,
+		"Fri, 01 Mar 2024 10:00:00 GMT": DateValue, "2024-13-01": StringValue, "": StringValue,
+	} {
+		c.Assert(InferType(value), check.Equals, expected, check.Commentf("%q", value))
+	}
+}
+
+func (s *EXMLSuite) Test_ProfileErrors(c *check.C) {
+	profile, err := Profile(strings.NewReader(MALFORMED))
+	c.Assert(err, check.NotNil)
+	c.Assert(profile.Paths, check.HasLen, 1)
+	c.Assert(profile.Paths[0].Path, check.Equals, "root")
+}
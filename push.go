@@ -0,0 +1,138 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+// errNeedMore is returned to the xml.Decoder of a PushDecoder when it
+// reaches the end of the data written so far.
+var errNeedMore = errors.New("exml: need more data")
+
+// A PushDecoder is an exml parser which is fed with data as it arrives
+// instead of pulling it from a reader, which suits event loops receiving
+// XML in arbitrary chunks, XMPP streams or long-lived HTTP responses. All
+// the registration methods of the embedded Decoder are available, Run must
+// not be called though: callbacks are dispatched from Write for every
+// complete token, partial ones being buffered until more data is written.
+// Only UTF-8 input is supported.
+type PushDecoder struct {
+	*Decoder
+	buf      []byte
+	bufStart int64
+	reader   *pushReader
+	started  bool
+	err      error
+}
+
+// NewPushDecoder creates a new push parser.
+func NewPushDecoder() *PushDecoder {
+	p := &PushDecoder{}
+	p.reader = &pushReader{p: p}
+	p.Decoder = NewCustomDecoder(xml.NewDecoder(p.reader))
+	return p
+}
+
+// Write buffers the passed data and dispatches the callbacks for all the
+// complete tokens it contains. The returned error is the error which
+// stopped the parsing, in which case subsequent writes fail with the same
+// error.
+func (p *PushDecoder) Write(data []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+
+	p.buf = append(p.buf, data...)
+	if p.err = p.parse(false); p.err != nil {
+		p.err = p.wait(p.err)
+	}
+	return len(data), p.err
+}
+
+// Close dispatches the callbacks for the remaining data, which must end
+// the document, and returns the error which stopped the parsing if any.
+func (p *PushDecoder) Close() error {
+	if p.err == nil {
+		p.err = p.wait(p.parse(true))
+	}
+
+	if p.err == io.ErrClosedPipe {
+		return nil
+	}
+
+	err := p.err
+	p.err = io.ErrClosedPipe
+	return err
+}
+
+// parse dispatches the tokens available in the buffer. Unless the data is
+// final, the xml.Decoder is only fed up to the last '>' of the buffer,
+// since what follows is at best a partial text token. Whenever the
+// xml.Decoder runs out of data, it is discarded and parsing restarts from
+// the last complete token with a new one on the next call.
+func (p *PushDecoder) parse(final bool) error {
+	if !p.started {
+		p.started = true
+		p.start()
+	} else if p.reader.pos > 0 || p.reader.exhausted {
+		if err := p.restart(); err != nil {
+			return p.fail(err)
+		}
+	}
+
+	p.reader.final = final
+	p.reader.end = len(p.buf)
+	if !final {
+		p.reader.end = bytes.LastIndexByte(p.buf, '>') + 1
+	}
+
+	for {
+		done, err := p.next()
+		if !done {
+			continue
+		}
+
+		if err == errNeedMore {
+			return nil
+		}
+
+		return err
+	}
+}
+
+// restart drops the consumed data and primes a new xml.Decoder with the
+// open elements to parse the remaining data.
+func (p *PushDecoder) restart() error {
+	consumed := int(p.offset - p.bufStart)
+	p.buf = p.buf[:copy(p.buf, p.buf[consumed:])]
+	p.bufStart = p.offset
+
+	p.reader = &pushReader{p: p}
+	return p.prime(p.reader, p.stack, p.offset, p.line, p.column)
+}
+
+// A pushReader feeds the buffered data of a PushDecoder to its xml.Decoder.
+type pushReader struct {
+	p         *PushDecoder
+	pos       int
+	end       int
+	final     bool
+	exhausted bool
+}
+
+func (r *pushReader) Read(b []byte) (int, error) {
+	if r.pos >= r.end {
+		if r.final {
+			return 0, io.EOF
+		}
+
+		r.exhausted = true
+		return 0, errNeedMore
+	}
+
+	n := copy(b, r.p.buf[r.pos:r.end])
+	r.pos += n
+	return n, nil
+}
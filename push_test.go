@@ -0,0 +1,119 @@
+package exml
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const PUSH = `<?xml version="1.0"?>
+<stream:stream xmlns:stream="http://etherx.jabber.org/streams" xmlns="jabber:client">
+    <message to="a&gt;b" from="b>c"><body>x &gt; y &amp; z</body></message>
+    <message to="c"><body><![CDATA[<not a tag>]]></body><!-- > --></message>
+    <presence type="away"/>
+</stream:stream>`
+
+func recordPush(d *Decoder, events *[]string) {
+	d.On("stream", func(attrs Attrs) {
+		*events = append(*events, "stream")
+		d.On("message", func(attrs Attrs) {
+			*events = append(*events, "message "+attrs.GetString("to", "")+" "+attrs.GetString("from", ""))
+			d.OnTextOf("body", func(text CharData) {
+				*events = append(*events, "body "+string(text))
+			})
+		})
+		d.On("presence", func(attrs Attrs) {
+			*events = append(*events, "presence "+attrs.GetString("type", ""))
+		})
+	})
+}
+
+func (s *EXMLSuite) Test_PushDecoder(c *check.C) {
+	expected := []string{}
+	decoder := NewDecoder(strings.NewReader(PUSH))
+	recordPush(decoder, &expected)
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(expected, check.HasLen, 6)
+
+	random := rand.New(rand.NewSource(1))
+	for size := 1; size <= len(PUSH); size = size*2 + random.Intn(3) {
+		events := []string{}
+		push := NewPushDecoder()
+		recordPush(push.Decoder, &events)
+
+		data := []byte(PUSH)
+		for len(data) > 0 {
+			n := min(1+random.Intn(size), len(data))
+			written, err := push.Write(data[:n])
+			c.Assert(err, check.IsNil)
+			c.Assert(written, check.Equals, n)
+			data = data[n:]
+		}
+
+		c.Assert(push.Close(), check.IsNil)
+		c.Assert(events, check.DeepEquals, expected)
+	}
+}
+
+func (s *EXMLSuite) Test_PushDecoderIncremental(c *check.C) {
+	events := []string{}
+	push := NewPushDecoder()
+	recordPush(push.Decoder, &events)
+
+	push.Write([]byte(`<stream xmlns="jabber:client"><message to="a"><bo`))
+	c.Assert(events, check.DeepEquals, []string{"stream", "message a "})
+
+	push.Write([]byte(`dy>hi</body></message><pres`))
+	c.Assert(events, check.DeepEquals, []string{"stream", "message a ", "body hi"})
+
+	push.Write([]byte(`ence type="dnd"/>`))
+	c.Assert(events, check.DeepEquals, []string{"stream", "message a ", "body hi", "presence dnd"})
+
+	push.Write([]byte(`</stream>`))
+	c.Assert(push.Close(), check.IsNil)
+}
+
+func (s *EXMLSuite) Test_PushDecoderPositions(c *check.C) {
+	push := NewPushDecoder()
+
+	var cbErr *CallbackError
+	push.OnError(func(err error) {
+		errors.As(err, &cbErr)
+	})
+	push.OnE("root/item", func(attrs Attrs) error {
+		if attrs.GetString("id", "") == "2" {
+			return errCallback
+		}
+		return nil
+	})
+
+	input := "<root>\n  <item id=\"1\"/>\n  <item id=\"2\"/>\n</root>"
+	for i := range input {
+		_, err := push.Write([]byte(input[i : i+1]))
+		if err != nil {
+			break
+		}
+	}
+
+	c.Assert(cbErr, check.NotNil)
+	c.Assert(cbErr.Line, check.Equals, 3)
+	c.Assert(cbErr.Column, check.Equals, 3)
+	c.Assert(cbErr.Offset, check.Equals, int64(26))
+}
+
+func (s *EXMLSuite) Test_PushDecoderErrors(c *check.C) {
+	push := NewPushDecoder()
+	_, err := push.Write([]byte("<root><a></b>"))
+	c.Assert(err, check.NotNil)
+
+	_, again := push.Write([]byte("</root>"))
+	c.Assert(again, check.Equals, err)
+	c.Assert(push.Close(), check.Equals, err)
+
+	push = NewPushDecoder()
+	_, err = push.Write([]byte("<root><a>"))
+	c.Assert(err, check.IsNil)
+	c.Assert(push.Close(), check.NotNil)
+}
@@ -0,0 +1,162 @@
+package exml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A ResyncError is reported to the error handler when parsing recovered
+// from malformed input, see Decoder.ResyncOn. Path, Line and Offset locate
+// the error, Resumed is the offset of the record parsing resumed at.
+type ResyncError struct {
+	Path    string
+	Line    int
+	Offset  int64
+	Resumed int64
+	Err     error
+}
+
+func (e *ResyncError) Error() string {
+	return fmt.Sprintf("exml: line %d: %s: %v (resumed at offset %d)", e.Line, e.Path, e.Err, e.Resumed)
+}
+
+func (e *ResyncError) Unwrap() error {
+	return e.Err
+}
+
+// ResyncOn enables the recovery from malformed input inside the records at
+// the passed path, for example "events/event" for a log file where each
+// event is independent from the others. When the underlying xml.Decoder
+// reports a syntax error inside a record, or between two records, the
+// input is scanned forward to the start tag of the next record and parsing
+// resumes from there. The partial record is dropped without its pending
+// text content being dispatched, and the error is reported to the error
+// handler as a *ResyncError. Run returns nil when the end of the input is
+// reached while looking for the next record.
+//
+// The recovery is only available to decoders created by NewDecoder or
+// NewHTMLDecoder, for UTF-8 or UTF-16 documents. The next start tag is
+// searched for textually, a record start tag appearing in a comment or a
+// CDATA section after the error would be picked as well.
+func (d *Decoder) ResyncOn(recordPath string) {
+	d.record = strings.Split(recordPath, "/")
+	if d.html {
+		d.record = strings.Split(strings.ToLower(recordPath), "/")
+	}
+}
+
+// canResync returns true when an error returned by the underlying decoder
+// happened inside a record or between two records.
+func (d *Decoder) canResync(err error) bool {
+	if d.record == nil || d.stream == nil {
+		return false
+	}
+
+	var syntaxErr *xml.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return false
+	}
+
+	parent := d.record[:len(d.record)-1]
+	if len(d.stack) < len(parent) {
+		return false
+	}
+
+	for i, name := range parent {
+		if d.stack[i].name.Local != name {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resync drops the current record, looks for the start tag of the next one
+// and primes a new decoder with the enclosing elements.
+func (d *Decoder) resync(err error) error {
+	line, column, offset := d.position()
+	resyncErr := &ResyncError{Path: d.path(), Line: line, Offset: offset, Err: err}
+
+	// The decoder may have read one byte ahead of its position.
+	if d.stream.n > offset {
+		d.stream.unreadByte()
+	}
+
+	parent := len(d.record) - 1
+	for _, f := range d.stack[parent:] {
+		f.handler.text = f.handler.text[:0]
+	}
+	d.stack = d.stack[:parent]
+	d.currentHandler = d.topHandler
+	if parent > 0 {
+		d.currentHandler = d.stack[parent-1].handler
+	}
+	d.skip = 0
+
+	line, column, found := d.scanRecord(line, column)
+	resyncErr.Resumed = d.stream.n
+	d.report(resyncErr)
+	if !found {
+		d.stack = d.stack[:0]
+		d.currentHandler = d.topHandler
+		return nil
+	}
+
+	if err := d.prime(d.stream, d.stack, d.stream.n, line, column); err != nil {
+		return d.fail(err)
+	}
+
+	return nil
+}
+
+// scanRecord consumes the input up to the next start tag of a record,
+// keeping track of the position from the passed one.
+func (d *Decoder) scanRecord(line int, column int) (int, int, bool) {
+	r := d.stream.r
+	name := []byte(d.record[len(d.record)-1])
+
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return line, column, false
+		}
+
+		if b[0] == '<' && isStartTagOf(r, name) {
+			return line, column, true
+		}
+
+		r.ReadByte()
+		d.stream.n++
+		if b[0] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+}
+
+// isStartTagOf returns true when the buffered input starts with a start tag
+// whose local name is the passed one.
+func isStartTagOf(r *bufio.Reader, local []byte) bool {
+	head, _ := r.Peek(len(local) + 128)
+	if len(head) < 2 {
+		return false
+	}
+
+	end := bytes.IndexAny(head[1:], " \t\r\n/>")
+	if end < 0 {
+		return false
+	}
+
+	qname := head[1 : 1+end]
+	if i := bytes.IndexByte(qname, ':'); i >= 0 {
+		qname = qname[i+1:]
+	}
+
+	return bytes.Equal(qname, local)
+}
@@ -0,0 +1,87 @@
+package exml
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const EVENTS = `<?xml version="1.0"?>
+<log:events xmlns:log="http://example.com/log">
+    <log:event id="1"><message>First</message></log:event>
+    <log:event id="2"><message>Broken <b></message></log:event>
+    <log:event id="3"><message>Third</message></log:event>
+    <log:event id="4" <message>Garbage</message></log:event>
+    <log:event id="5"><message>Fifth &amp; last</message></log:event>
+</log:events>`
+
+func (s *EXMLSuite) Test_Resync(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(EVENTS))
+	decoder.ResyncOn("events/event")
+
+	errs := []*ResyncError{}
+	decoder.OnError(func(err error) {
+		var resyncErr *ResyncError
+		c.Assert(errors.As(err, &resyncErr), check.Equals, true)
+		errs = append(errs, resyncErr)
+	})
+
+	ids := []string{}
+	messages := []string{}
+	decoder.On("events/event", func(attrs Attrs) {
+		id, _ := attrs.Get("id")
+		ids = append(ids, id)
+		decoder.OnTextOf("message", Append(&messages))
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(ids, check.DeepEquals, []string{"1", "2", "3", "5"})
+	c.Assert(messages, check.DeepEquals, []string{"First", "Broken", "Third", "Fifth & last"})
+
+	c.Assert(errs, check.HasLen, 2)
+	c.Assert(errs[0].Path, check.Equals, "events/event/message/b")
+	c.Assert(errs[0].Line, check.Equals, 4)
+	c.Assert(errs[0].Resumed, check.Equals, int64(strings.Index(EVENTS, `<log:event id="3"`)))
+	c.Assert(errors.As(errs[0], new(*xml.SyntaxError)), check.Equals, true)
+	c.Assert(errs[1].Line, check.Equals, 6)
+	c.Assert(errs[1].Resumed, check.Equals, int64(strings.Index(EVENTS, `<log:event id="5"`)))
+}
+
+func (s *EXMLSuite) Test_ResyncPositions(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(EVENTS))
+	decoder.ResyncOn("events/event")
+	decoder.SetErrorPolicy(ContinueOnError)
+
+	lines := []int{}
+	columns := []int{}
+	offsets := []int64{}
+	decoder.OnE("events/event", func(attrs Attrs) error {
+		return errCallback
+	})
+	decoder.OnError(func(err error) {
+		var cbErr *CallbackError
+		if errors.As(err, &cbErr) {
+			lines = append(lines, cbErr.Line)
+			columns = append(columns, cbErr.Column)
+			offsets = append(offsets, cbErr.Offset)
+		}
+	})
+
+	c.Assert(decoder.Run(), check.IsNil)
+	c.Assert(lines, check.DeepEquals, []int{3, 4, 5, 7})
+	c.Assert(columns, check.DeepEquals, []int{5, 5, 5, 5})
+	c.Assert(offsets[2], check.Equals, int64(strings.Index(EVENTS, `<log:event id="3"`)))
+	c.Assert(offsets[3], check.Equals, int64(strings.Index(EVENTS, `<log:event id="5"`)))
+}
+
+func (s *EXMLSuite) Test_ResyncOutsideRecords(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(MALFORMED))
+	decoder.ResyncOn("root/node")
+	c.Assert(decoder.Run(), check.FitsTypeOf, &xml.SyntaxError{})
+
+	decoder = NewDecoder(strings.NewReader(EVENTS))
+	decoder.ResyncOn("other/event")
+	c.Assert(decoder.Run(), check.FitsTypeOf, &xml.SyntaxError{})
+}
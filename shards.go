@@ -0,0 +1,343 @@
+package exml
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// ParseShards parses a large file with n decoders running concurrently, each
+// of them parsing a shard of the file. The file is first scanned for the
+// start tags of the elements named recordTag, at the depth of the first of
+// them and outside of comments, CDATA sections and processing instructions,
+// and split at the records closest to n equally sized byte ranges. This
+// scan only looks for markup delimiters and is much faster than the actual
+// parsing.
+//
+// Every decoder is configured by setup and parses a well-formed document:
+// the start tags of the elements enclosing its first record are parsed
+// before the shard, with their attributes and namespace declarations, and
+// the elements left open at its end are closed after it. Handlers thus see
+// the same paths as when parsing the whole file, and the tag callbacks of
+// these enclosing elements are called by every decoder. Positions reported
+// by the decoders are positions in the file. Since setup and the callbacks
+// are called concurrently, they must synchronize the accesses to shared
+// state.
+//
+// Only UTF-8 documents are supported, UTF-16 documents and documents
+// declaring another encoding being rejected. As for checkpoints, offsets
+// don't count the byte order mark. The returned error joins the errors
+// returned by the Run methods of the decoders.
+func ParseShards(f *os.File, recordTag string, n int, setup func(*Decoder)) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var head [headSize]byte
+	m, err := f.ReadAt(head[:], 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	bom, err := offsetBase(head[:m])
+	if err != nil {
+		return err
+	}
+
+	// Offsets are offsets past the byte order mark, in the whole file.
+	size := info.Size() - bom
+	bounds, err := findBoundaries(io.NewSectionReader(f, bom, size), recordTag, size, n)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(bounds)+1)
+	var wg sync.WaitGroup
+	for i := range errs {
+		var from, to *boundary
+		if i > 0 {
+			from = &bounds[i-1]
+		}
+		if i < len(bounds) {
+			to = &bounds[i]
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := shardDecoder(f, bom, size, from, to)
+			setup(d)
+			errs[i] = d.Run()
+		}()
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// A boundary is the position of a record start tag at which a file is
+// split, along with the start tags and names of the elements enclosing it.
+type boundary struct {
+	offset int64
+	line   int
+	column int
+	open   [][]byte
+	names  [][]byte
+}
+
+// shardDecoder returns a decoder parsing the part of a file between two
+// boundaries, nil standing for the start and the end of the file. The
+// first shard starts with the byte order mark, which NewDecoder removes.
+func shardDecoder(f *os.File, bom int64, size int64, from *boundary, to *boundary) *Decoder {
+	start, end := int64(0), bom+size
+	if from != nil {
+		start = bom + from.offset
+	}
+
+	var closing bytes.Buffer
+	if to != nil {
+		end = bom + to.offset
+		for _, name := range slices.Backward(to.names) {
+			closing.WriteString("</")
+			closing.Write(name)
+			closing.WriteByte('>')
+		}
+	}
+
+	d := NewDecoder(io.MultiReader(io.NewSectionReader(f, start, end-start), &closing))
+	if from != nil {
+		// Line breaks inside the start tags would shift the lines of the
+		// positions reported for the shard.
+		pre := bytes.Join(from.open, nil)
+		for i, b := range pre {
+			if b == '\n' || b == '\r' {
+				pre[i] = ' '
+			}
+		}
+
+		d.stream.prelude = pre
+		d.locate(len(pre), from.offset, from.line, from.column)
+	}
+
+	return d
+}
+
+// findBoundaries scans an input for the start tags of records and returns
+// the ones closest to the n-1 offsets splitting it in equally sized parts.
+func findBoundaries(r io.Reader, recordTag string, size int64, n int) ([]boundary, error) {
+	s := &shardScanner{r: bufio.NewReaderSize(r, 64*1024), line: 1}
+	local := []byte(recordTag)
+	depth := -1
+	bounds := []boundary{}
+
+	for k := 1; k < n; {
+		if err := s.skipText(); err != nil {
+			return bounds, ignoreEOF(err)
+		}
+
+		start, line, column := s.offset-1, s.line, int(s.offset-s.nl)
+		b, err := s.readByte()
+		if err != nil {
+			return bounds, ignoreEOF(err)
+		}
+
+		switch b {
+		case '!':
+			err = s.skipDeclaration()
+		case '?':
+			err = s.skipPast("?>")
+		case '/':
+			err = s.skipPast(">")
+			if len(s.open) > 0 {
+				s.open = s.open[:len(s.open)-1]
+				s.names = s.names[:len(s.names)-1]
+			}
+		default:
+			var tag []byte
+			var empty bool
+			tag, empty, err = s.readTag(b)
+			if err != nil {
+				break
+			}
+
+			name := tagName(tag)
+			if (depth < 0 || depth == len(s.open)) && bytes.Equal(localName(name), local) {
+				depth = len(s.open)
+				if start >= size*int64(k)/int64(n) {
+					bounds = append(bounds, boundary{
+						offset: start,
+						line:   line,
+						column: column,
+						open:   slices.Clone(s.open),
+						names:  slices.Clone(s.names),
+					})
+					for k < n && start >= size*int64(k)/int64(n) {
+						k++
+					}
+				}
+			}
+
+			if !empty {
+				s.open = append(s.open, tag)
+				s.names = append(s.names, name)
+			}
+		}
+
+		if err != nil {
+			return bounds, ignoreEOF(err)
+		}
+	}
+
+	return bounds, nil
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// A shardScanner looks for the markup delimiters of an input, keeping
+// track of the position and of the start tags of the open elements.
+type shardScanner struct {
+	r      *bufio.Reader
+	offset int64
+	line   int
+	nl     int64
+	open   [][]byte
+	names  [][]byte
+}
+
+func (s *shardScanner) readByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	s.offset++
+	if b == '\n' {
+		s.line++
+		s.nl = s.offset
+	}
+	return b, nil
+}
+
+// skipText consumes the input up to the next '<' included.
+func (s *shardScanner) skipText() error {
+	for {
+		chunk, err := s.r.ReadSlice('<')
+		s.offset += int64(len(chunk))
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			s.line += bytes.Count(chunk, []byte{'\n'})
+			s.nl = s.offset - int64(len(chunk)-i-1)
+		}
+
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// skipPast consumes the input up to the passed delimiter included.
+func (s *shardScanner) skipPast(delim string) error {
+	window := make([]byte, 0, len(delim))
+	for {
+		b, err := s.readByte()
+		if err != nil {
+			return err
+		}
+
+		if len(window) == len(delim) {
+			window = append(window[:0], window[1:]...)
+		}
+		window = append(window, b)
+		if string(window) == delim {
+			return nil
+		}
+	}
+}
+
+// skipDeclaration consumes a comment, a CDATA section or a declaration
+// following "<!".
+func (s *shardScanner) skipDeclaration() error {
+	head, _ := s.r.Peek(7)
+	switch {
+	case bytes.HasPrefix(head, []byte("--")):
+		return s.skipPast("-->")
+	case bytes.HasPrefix(head, []byte("[CDATA[")):
+		return s.skipPast("]]>")
+	}
+
+	// A DOCTYPE declaration, possibly with an internal subset.
+	var quote byte
+	brackets := 0
+	for {
+		b, err := s.readByte()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '"' || b == '\'':
+			quote = b
+		case b == '[':
+			brackets++
+		case b == ']':
+			brackets--
+		case b == '>' && brackets <= 0:
+			return nil
+		}
+	}
+}
+
+// readTag reads a start tag whose first byte following '<' was already
+// consumed. It returns the whole tag and whether the element is empty.
+func (s *shardScanner) readTag(first byte) ([]byte, bool, error) {
+	tag := []byte{'<', first}
+	var quote byte
+	for {
+		b, err := s.readByte()
+		if err != nil {
+			return nil, false, err
+		}
+
+		tag = append(tag, b)
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '"' || b == '\'':
+			quote = b
+		case b == '>':
+			return tag, tag[len(tag)-2] == '/', nil
+		}
+	}
+}
+
+// tagName returns the qualified name of a start tag.
+func tagName(tag []byte) []byte {
+	name := tag[1:]
+	if i := bytes.IndexAny(name, " \t\r\n/>"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// localName returns the local part of a qualified name.
+func localName(name []byte) []byte {
+	if i := bytes.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
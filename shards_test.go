@@ -0,0 +1,146 @@
+package exml
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/check.v1"
+)
+
+func shardedDump(n int) string {
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\"?>\n<!DOCTYPE osm [<!ENTITY x \"<node>\">]>\n")
+	b.WriteString("<osm:osm xmlns:osm=\"urn:osm\"\n     version=\"0.6\">\n")
+	for i := range n {
+		switch i % 4 {
+		case 0:
+			b.WriteString("  <!-- <osm:node id=\"fake\"> -->\n")
+		case 1:
+			b.WriteString("  <osm:note><![CDATA[<osm:node id=\"fake\">]]></osm:note>\n")
+		case 2:
+			b.WriteString("  <?pi <osm:node id=\"fake\"> ?>\n")
+		}
+		fmt.Fprintf(&b, "  <osm:node id=\"%d\" name='a > b'>\n    <osm:tag k=\"k%d\"/>\n    <osm:node id=\"nested\"/>\n  </osm:node>\n", i, i)
+	}
+	b.WriteString("</osm:osm>\n")
+	return b.String()
+}
+
+func (s *EXMLSuite) Test_ParseShards(c *check.C) {
+	data := shardedDump(500)
+	name := filepath.Join(c.MkDir(), "dump.xml")
+	c.Assert(os.WriteFile(name, []byte(data), 0o644), check.IsNil)
+
+	f, err := os.Open(name)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+
+	for _, n := range []int{1, 2, 7, 64, 1000} {
+		var mu sync.Mutex
+		ids := []string{}
+		tags := 0
+		roots := 0
+
+		err := ParseShards(f, "node", n, func(d *Decoder) {
+			d.On("osm", func(attrs Attrs) {
+				mu.Lock()
+				roots++
+				mu.Unlock()
+				c.Check(attrs.GetString("version", ""), check.Equals, "0.6")
+
+				d.On("node", func(attrs Attrs) {
+					mu.Lock()
+					ids = append(ids, attrs.GetString("id", ""))
+					mu.Unlock()
+					c.Check(attrs.GetString("name", ""), check.Equals, "a > b")
+					c.Check(d.element.Space, check.Equals, "urn:osm")
+
+					d.On("tag", func(attrs Attrs) {
+						mu.Lock()
+						tags++
+						mu.Unlock()
+					})
+				})
+			})
+		})
+		c.Assert(err, check.IsNil)
+
+		expected := []string{}
+		for i := range 500 {
+			expected = append(expected, fmt.Sprint(i))
+		}
+		slices.Sort(ids)
+		slices.Sort(expected)
+		c.Assert(ids, check.DeepEquals, expected)
+		c.Assert(tags, check.Equals, 500)
+		c.Assert(roots >= 1 && roots <= n, check.Equals, true)
+		if n == 7 {
+			c.Assert(roots, check.Equals, 7)
+		}
+	}
+}
+
+func (s *EXMLSuite) Test_ParseShardsPositions(c *check.C) {
+	data := shardedDump(100)
+	name := filepath.Join(c.MkDir(), "dump.xml")
+	c.Assert(os.WriteFile(name, []byte(data), 0o644), check.IsNil)
+
+	f, err := os.Open(name)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+
+	err = ParseShards(f, "node", 4, func(d *Decoder) {
+		d.OnE("osm/node", func(attrs Attrs) error {
+			if attrs.GetString("id", "") == "77" {
+				return errCallback
+			}
+			return nil
+		})
+	})
+
+	var cbErr *CallbackError
+	c.Assert(errors.As(err, &cbErr), check.Equals, true)
+	offset := strings.Index(data, `<osm:node id="77"`)
+	c.Assert(cbErr.Offset, check.Equals, int64(offset))
+	c.Assert(cbErr.Line, check.Equals, strings.Count(data[:offset], "\n")+1)
+	c.Assert(cbErr.Column, check.Equals, 3)
+	c.Assert(cbErr.Path, check.Equals, "osm/node")
+}
+
+func (s *EXMLSuite) Test_ParseShardsEncodings(c *check.C) {
+	data := shardedDump(100)
+	name := filepath.Join(c.MkDir(), "dump.xml")
+	c.Assert(os.WriteFile(name, []byte("\xef\xbb\xbf"+data), 0o644), check.IsNil)
+
+	f, err := os.Open(name)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+
+	var mu sync.Mutex
+	offsets := map[string]int64{}
+	err = ParseShards(f, "node", 4, func(d *Decoder) {
+		d.On("osm/node", func(attrs Attrs) {
+			mu.Lock()
+			offsets[attrs.GetString("id", "")] = d.Checkpoint().Offset
+			mu.Unlock()
+		})
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(offsets, check.HasLen, 100)
+	for _, id := range []string{"0", "30", "77", "99"} {
+		c.Assert(offsets[id], check.Equals, int64(strings.Index(data, `<osm:node id="`+id+`"`)))
+	}
+
+	latin1 := filepath.Join(c.MkDir(), "latin1.xml")
+	c.Assert(os.WriteFile(latin1, []byte(strings.Replace(data, `version="1.0"`, `version="1.0" encoding="ISO-8859-1"`, 1)), 0o644), check.IsNil)
+	f, err = os.Open(latin1)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	err = ParseShards(f, "node", 4, func(d *Decoder) {})
+	c.Assert(err, check.ErrorMatches, "exml: offsets in ISO-8859-1 documents are not supported")
+}
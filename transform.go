@@ -0,0 +1,281 @@
+package exml
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A Transformer is an exml parser copying the document it reads to a
+// writer, where the callbacks of the handlers can alter the copy with the
+// Drop, Replace, Inject, Rename, SetAttr and RemoveAttr methods of the
+// decoder, or by modifying the values of the attributes they get. The
+// tokens which are left untouched are copied byte for byte, including
+// comments, processing instructions, entity references and the layout of
+// the tags, and the altered ones are written in a canonical form. As with
+// Filter, a text callback which drops or replaces the text also removes
+// the comments and processing instructions mixed with it. Only UTF-8 and
+// US-ASCII documents are supported.
+type Transformer struct {
+	*Decoder
+	f   *filter
+	enc *Encoder
+}
+
+// NewTransformer creates a new exml transformer reading the document read
+// from r and writing the transformed copy to w when Run is called.
+func NewTransformer(r io.Reader, w io.Writer) *Transformer {
+	input := &inputReader{r: r}
+	tape := &tape{r: bufio.NewReader(input)}
+	xd := xml.NewDecoder(tape)
+	xd.CharsetReader = transformCharsetReader
+
+	f := &filter{tape: tape}
+	f.d = NewCustomDecoder(xd)
+	f.d.input = input
+	f.d.recordTokens(f.read)
+	f.d.filter = f
+
+	return &Transformer{Decoder: f.d, f: f, enc: NewEncoder(w)}
+}
+
+// transformCharsetReader accepts the charsets which are subsets of UTF-8,
+// the raw input being copied as is.
+func transformCharsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "us-ascii", "ascii", "iso646-us", "ansi_x3.4-1968":
+		return input, nil
+	}
+
+	return nil, fmt.Errorf("exml: unsupported charset %q for transformation", label)
+}
+
+// Run reads the whole input and writes the transformed document. It
+// returns the error which stopped it like Decoder.Run, the output then
+// being truncated, or the first error returned by the writer.
+func (t *Transformer) Run() error {
+	for {
+		if t.enc.dst.err != nil {
+			return t.enc.dst.err
+		}
+
+		token, err := t.f.Token()
+		if err == io.EOF {
+			return t.enc.Flush()
+		}
+		if err != nil {
+			t.enc.Flush()
+			return err
+		}
+
+		t.enc.write(token)
+	}
+}
+
+// An Encoder writes XML tokens to a writer. Unlike with an xml.Encoder, the
+// names are written with the prefixes bound by the namespace declarations
+// among the attributes of the start elements written so far, so that the
+// tokens read from an xml.Decoder or a Filter are written as they appeared
+// in the document. Names whose namespace is not bound are written with the
+// namespace as prefix. Line breaks are not escaped in text, unlike with
+// xml.EscapeText.
+type Encoder struct {
+	w   *bufio.Writer
+	dst *errWriter
+	out []frame
+}
+
+// NewEncoder creates a new encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	dst := &errWriter{w: w}
+	return &Encoder{w: bufio.NewWriter(dst), dst: dst}
+}
+
+// EncodeToken writes a token, the output being buffered until Flush is
+// called. End elements close the innermost open element and are ignored
+// when no element is open. The returned error is the first error returned
+// by the writer.
+func (e *Encoder) EncodeToken(t xml.Token) error {
+	e.write(t)
+	return e.dst.err
+}
+
+// Flush writes the buffered output to the writer.
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// write writes a token to the output, errors being reported by Flush.
+func (e *Encoder) write(token xml.Token) {
+	switch tok := token.(type) {
+	case rawToken:
+		switch inner := tok.token.(type) {
+		case xml.StartElement:
+			e.out = append(e.out, frame{name: inner.Name, attr: inner.Attr})
+		case xml.EndElement:
+			e.out = e.out[:len(e.out)-1]
+		}
+		e.w.Write(tok.raw)
+
+	case xml.StartElement:
+		e.out = append(e.out, frame{name: tok.Name, attr: tok.Attr})
+		e.w.WriteByte('<')
+		e.w.WriteString(qualifiedName(e.out, tok.Name))
+		for _, attr := range tok.Attr {
+			e.w.WriteByte(' ')
+			e.w.WriteString(attrName(e.out, attr.Name))
+			e.w.WriteString(`="`)
+			xml.EscapeText(e.w, []byte(attr.Value))
+			e.w.WriteByte('"')
+		}
+		e.w.WriteByte('>')
+
+	case xml.EndElement:
+		e.writeEnd(tok)
+
+	case xml.CharData:
+		escapeText(e.w, tok)
+
+	case xml.Comment:
+		e.w.WriteString("<!--")
+		e.w.Write(tok)
+		e.w.WriteString("-->")
+
+	case xml.ProcInst:
+		e.w.WriteString("<?")
+		e.w.WriteString(tok.Target)
+		if len(tok.Inst) > 0 {
+			e.w.WriteByte(' ')
+			e.w.Write(tok.Inst)
+		}
+		e.w.WriteString("?>")
+
+	case xml.Directive:
+		e.w.WriteString("<!")
+		e.w.Write(tok)
+		e.w.WriteByte('>')
+	}
+}
+
+// writeEnd writes the end tag of the innermost written element.
+func (e *Encoder) writeEnd(tok xml.EndElement) {
+	if len(e.out) == 0 {
+		return
+	}
+
+	e.w.WriteString("</")
+	e.w.WriteString(qualifiedName(e.out, tok.Name))
+	e.w.WriteByte('>')
+	e.out = e.out[:len(e.out)-1]
+}
+
+// attrName returns the name of an attribute as it appears in the document,
+// looking up the prefix bound to its namespace in the declarations of the
+// passed open elements, the innermost being the last. Unlike element
+// names, attribute names are not in the default namespace.
+func attrName(open []frame, name xml.Name) string {
+	switch name.Space {
+	case "":
+		return name.Local
+	case "xmlns":
+		return "xmlns:" + name.Local
+	case xmlURL:
+		return "xml:" + name.Local
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		for _, attr := range open[i].attr {
+			if attr.Name.Space == "xmlns" && attr.Value == name.Space {
+				return attr.Name.Local + ":" + name.Local
+			}
+		}
+	}
+
+	return name.Space + ":" + name.Local
+}
+
+// escapeText writes text escaped for element content, line breaks being
+// kept unlike with xml.EscapeText.
+func escapeText(w *bufio.Writer, text []byte) {
+	last := 0
+	for i, c := range text {
+		var esc string
+		switch c {
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '\r':
+			esc = "&#xD;"
+		default:
+			continue
+		}
+
+		w.Write(text[last:i])
+		w.WriteString(esc)
+		last = i + 1
+	}
+	w.Write(text[last:])
+}
+
+// An errWriter records the first error returned by a writer so that
+// parsing stops when the output fails.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.w.Write(p)
+	w.err = err
+	return n, err
+}
+
+// A rawToken is a token along with its raw input, which a transformer
+// copies as is. The raw input of an end element is empty when its start
+// tag is self-closing, the filter only copying both tags or neither.
+type rawToken struct {
+	raw   []byte
+	token xml.Token
+}
+
+// A tape records the bytes read by an xml.Decoder, which reads its input
+// byte by byte, until they are taken as the raw input of a token.
+type tape struct {
+	r    *bufio.Reader
+	buf  []byte
+	used int
+	n    int64
+}
+
+func (t *tape) ReadByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	if err == nil {
+		t.buf = append(t.buf, b)
+	}
+	return b, err
+}
+
+func (t *tape) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.buf = append(t.buf, p[:n]...)
+	return n, err
+}
+
+// take returns the bytes recorded up to the passed input offset. The
+// returned bytes are only valid until the next call, the bytes returned by
+// the previous call being discarded.
+func (t *tape) take(offset int64) []byte {
+	t.buf = t.buf[:copy(t.buf, t.buf[t.used:])]
+	t.used = int(offset - t.n)
+	t.n = offset
+	return t.buf[:t.used]
+}
@@ -0,0 +1,156 @@
+package exml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const TRANSFORM = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE config>
+<!-- exported configuration -->
+<config xmlns:x="urn:x" version='1.2'>
+    <module name="core"   version="1.2" x:debug="true"/>
+    <module name="extra" version="0.9"><![CDATA[raw <data>]]> &amp; text &#233;</module>
+    <users>
+        <user id="1" password="secret"><email>alice@example.com</email><phone/></user>
+        <user id="2" password="hunter2"><email>bob@example.com</email><phone>555</phone></user>
+    </users>
+    <?processing instruction?>
+</config>
+`
+
+func transform(doc string, setup func(t *Transformer)) (string, error) {
+	var out bytes.Buffer
+	t := NewTransformer(strings.NewReader(doc), &out)
+	setup(t)
+	err := t.Run()
+	return out.String(), err
+}
+
+func (s *EXMLSuite) Test_TransformPassthrough(c *check.C) {
+	for _, doc := range []string{TRANSFORM, EXAMPLE, NAMESPACED, CDATA, MIXED, NESTED_TEXT, DOCUMENTS[:strings.Index(DOCUMENTS, "\nstray")]} {
+		out, err := transform(doc, func(t *Transformer) {
+			t.On("module", func(attrs Attrs) {})
+			t.OnTextOf("email", func(text CharData) {})
+		})
+		c.Assert(err, check.IsNil)
+		c.Assert(out, check.Equals, doc)
+	}
+}
+
+func (s *EXMLSuite) Test_Transform(c *check.C) {
+	out, err := transform(TRANSFORM, func(t *Transformer) {
+		t.On("config", func(attrs Attrs) {
+			t.SetAttr("version", "1.3")
+		})
+		t.On("config/module", func(attrs Attrs) {
+			if name, _ := attrs.Get("name"); name == "core" {
+				t.SetAttr("version", "2.0")
+				t.RemoveAttr("debug")
+			} else {
+				t.Drop()
+			}
+		})
+		t.On("users", func(attrs Attrs) {
+			user := xml.StartElement{Name: xml.Name{Local: "user"}, Attr: []xml.Attr{{Name: xml.Name{Local: "id"}, Value: `"3"`}}}
+			t.Inject(user, user.End())
+
+			t.On("user", func(attrs Attrs) {
+				t.Rename("member")
+				t.RemoveAttr("password")
+				t.OnTextOf("email", func(text CharData) {
+					t.Replace(xml.CharData("<redacted>"))
+				})
+				t.OnTextOf("phone", func(text CharData) {
+					t.Inject(xml.Comment(" no phone "))
+				})
+			})
+		})
+	})
+
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE config>
+<!-- exported configuration -->
+<config xmlns:x="urn:x" version="1.3">
+    <module name="core" version="2.0"></module>
+    
+    <users><user id="&#34;3&#34;"></user>
+        <member id="1"><email>&lt;redacted&gt;</email><phone/></member>
+        <member id="2"><email>&lt;redacted&gt;</email><phone>555<!-- no phone --></phone></member>
+    </users>
+    <?processing instruction?>
+</config>
+`)
+}
+
+func (s *EXMLSuite) Test_TransformNamespaces(c *check.C) {
+	out, err := transform(NAMESPACED, func(t *Transformer) {
+		t.On("svg/a", func(attrs Attrs) {
+			for i := range attrs {
+				attrs[i].Value = strings.ToUpper(attrs[i].Value)
+			}
+		})
+	})
+
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+    <a href="PLAIN" xlink:href="LINKED"></a>
+</svg>`)
+}
+
+func (s *EXMLSuite) Test_TransformErrors(c *check.C) {
+	out, err := transform(MALFORMED, func(t *Transformer) {})
+	c.Assert(err, check.FitsTypeOf, &xml.SyntaxError{})
+	c.Assert(out, check.Equals, `<?xml version="1.0"?><root>`)
+
+	_, err = transform("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><a/>", func(t *Transformer) {})
+	c.Assert(err, check.ErrorMatches, `.*unsupported charset "ISO-8859-1" for transformation`)
+
+	out, err = transform("<?xml version=\"1.0\" encoding=\"US-ASCII\"?><a/>", func(t *Transformer) {})
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "<?xml version=\"1.0\" encoding=\"US-ASCII\"?><a/>")
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errCallback
+}
+
+func (s *EXMLSuite) Test_TransformWriteError(c *check.C) {
+	data := largeCatalog(1000)
+	t := NewTransformer(bytes.NewReader(data), failingWriter{})
+	c.Assert(t.Run(), check.Equals, errCallback)
+
+	_, _, offset := t.position()
+	c.Assert(offset < int64(len(data)), check.Equals, true)
+}
+
+func (s *EXMLSuite) Test_Encoder(c *check.C) {
+	var out bytes.Buffer
+	enc := NewEncoder(&out)
+	xd := xml.NewDecoder(strings.NewReader(NAMESPACED))
+	for {
+		t, err := xd.Token()
+		if err != nil {
+			break
+		}
+		c.Assert(enc.EncodeToken(t), check.IsNil)
+	}
+	c.Assert(enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "stray"}}), check.IsNil)
+	c.Assert(enc.Flush(), check.IsNil)
+	c.Assert(out.String(), check.Equals, `<?xml version="1.0"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink">
+    <a href="plain" xlink:href="linked"></a>
+</svg>`)
+
+	enc = NewEncoder(failingWriter{})
+	c.Assert(enc.EncodeToken(xml.CharData("text")), check.IsNil)
+	c.Assert(enc.Flush(), check.Equals, errCallback)
+	c.Assert(enc.EncodeToken(xml.CharData("text")), check.Equals, errCallback)
+}
@@ -0,0 +1,198 @@
+package exml
+
+import (
+	"encoding"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Unmarshal fills the struct pointed to by v from the attributes. Fields
+// are bound using either an `exml:"name"` tag or an `xml:"name,attr"` tag;
+// as with encoding/xml, the name can be preceded by a namespace URL and a
+// space to match a namespaced attribute. Untagged fields, fields tagged
+// with "-" and fields whose attribute is absent are left untouched.
+// Embedded structs are traversed.
+//
+// Supported field types are strings, bools, ints, uints, floats, types
+// implementing encoding.TextUnmarshaler (which includes time.Time, parsed
+// as RFC 3339) or xml.UnmarshalerAttr, and pointers to any of those. The
+// returned error joins an *AttrError for each value that could not be
+// converted.
+func (a Attrs) Unmarshal(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("exml: Unmarshal expects a non-nil struct pointer, got %T", v)
+	}
+
+	rv = rv.Elem()
+	var errs []error
+	for _, f := range attrFieldsOf(rv.Type()) {
+		val, ok := a.getField(f)
+		if !ok {
+			continue
+		}
+
+		fv := rv.FieldByIndex(f.index)
+		if err := setAttrValue(fv, xml.Attr{Name: f.name, Value: val}); err != nil {
+			errs = append(errs, &AttrError{
+				Attr:  f.name.Local,
+				Value: val,
+				Err:   fmt.Errorf("%w: %w", ErrInvalidAttr, err),
+			})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a Attrs) getField(f attrField) (string, bool) {
+	if f.name.Space == "" {
+		return a.Get(f.name.Local)
+	}
+
+	return a.GetNS(f.name.Space, f.name.Local)
+}
+
+type attrField struct {
+	name  xml.Name
+	index []int
+}
+
+var attrFieldsCache sync.Map // map[reflect.Type][]attrField
+
+func attrFieldsOf(t reflect.Type) []attrField {
+	if fields, ok := attrFieldsCache.Load(t); ok {
+		return fields.([]attrField)
+	}
+
+	fields := collectAttrFields(t, nil)
+	attrFieldsCache.Store(t, fields)
+	return fields
+}
+
+func collectAttrFields(t reflect.Type, parent []int) []attrField {
+	var fields []attrField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Tag.Get("exml") == "" && sf.Tag.Get("xml") == "" {
+			fields = append(fields, collectAttrFields(sf.Type, index)...)
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, ok := attrFieldName(sf.Tag)
+		if !ok {
+			continue
+		}
+
+		fields = append(fields, attrField{name: name, index: index})
+	}
+
+	return fields
+}
+
+func attrFieldName(tag reflect.StructTag) (xml.Name, bool) {
+	spec, ok := tag.Lookup("exml")
+	if !ok {
+		xmlSpec, ok := tag.Lookup("xml")
+		if !ok {
+			return xml.Name{}, false
+		}
+
+		opts := strings.Split(xmlSpec, ",")
+		isAttr := false
+		for _, opt := range opts[1:] {
+			isAttr = isAttr || opt == "attr"
+		}
+
+		if !isAttr {
+			return xml.Name{}, false
+		}
+
+		spec = opts[0]
+	}
+
+	if spec == "" || spec == "-" {
+		return xml.Name{}, false
+	}
+
+	if i := strings.LastIndexByte(spec, ' '); i >= 0 {
+		return xml.Name{Space: spec[:i], Local: spec[i+1:]}, true
+	}
+
+	return xml.Name{Local: spec}, true
+}
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	attrUnmarshalerType = reflect.TypeFor[xml.UnmarshalerAttr]()
+)
+
+func setAttrValue(fv reflect.Value, attr xml.Attr) error {
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+
+		return setAttrValue(fv.Elem(), attr)
+	}
+
+	if fv.CanAddr() {
+		pv := fv.Addr()
+		if pv.Type().Implements(attrUnmarshalerType) {
+			return pv.Interface().(xml.UnmarshalerAttr).UnmarshalXMLAttr(attr)
+		}
+
+		if pv.Type().Implements(textUnmarshalerType) {
+			return pv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(attr.Value))
+		}
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(attr.Value)
+
+	case reflect.Bool:
+		val, err := strconv.ParseBool(attr.Value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(val)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val, err := strconv.ParseInt(attr.Value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(val)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		val, err := strconv.ParseUint(attr.Value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(val)
+
+	case reflect.Float32, reflect.Float64:
+		val, err := strconv.ParseFloat(attr.Value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(val)
+
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package exml
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+const OSM = `<?xml version="1.0"?>
+<osm xmlns:meta="http://example.com/meta">
+    <node id="261728686" lat="54.0901746" lon="12.2482632" version="3" visible="true"
+          timestamp="2009-09-21T08:46:32Z" user="tester" meta:source="survey" />
+    <node id="foo" lat="bar" lon="12.5" />
+</osm>`
+
+type OSMMeta struct {
+	Source string `xml:"http://example.com/meta source,attr"`
+}
+
+type OSMNode struct {
+	OSMMeta
+	ID        int64     `exml:"id"`
+	Lat       float64   `exml:"lat"`
+	Lon       float32   `exml:"lon"`
+	Version   uint8     `xml:"version,attr"`
+	Visible   *bool     `exml:"visible"`
+	Timestamp time.Time `exml:"timestamp"`
+	User      string    `xml:"user"`
+	Ignored   string    `exml:"-"`
+}
+
+func (s *EXMLSuite) Test_AttrsUnmarshal(c *check.C) {
+	nodes := []*OSMNode{}
+	errs := []error{}
+
+	decoder := NewDecoder(strings.NewReader(OSM))
+	decoder.On("osm/node", func(attrs Attrs) {
+		node := &OSMNode{User: "default"}
+		errs = append(errs, attrs.Unmarshal(node))
+		nodes = append(nodes, node)
+	})
+	decoder.Run()
+
+	c.Assert(nodes, check.HasLen, 2)
+
+	n := nodes[0]
+	c.Assert(errs[0], check.IsNil)
+	c.Assert(n.ID, check.Equals, int64(261728686))
+	c.Assert(n.Lat, check.Equals, 54.0901746)
+	c.Assert(n.Lon, check.Equals, float32(12.2482632))
+	c.Assert(n.Version, check.Equals, uint8(3))
+	c.Assert(*n.Visible, check.Equals, true)
+	c.Assert(n.Timestamp.Equal(time.Date(2009, 9, 21, 8, 46, 32, 0, time.UTC)), check.Equals, true)
+	c.Assert(n.User, check.Equals, "default")
+	c.Assert(n.Source, check.Equals, "survey")
+
+	n = nodes[1]
+	c.Assert(n.Lon, check.Equals, float32(12.5))
+	c.Assert(n.Visible, check.IsNil)
+	c.Assert(errors.Is(errs[1], ErrInvalidAttr), check.Equals, true)
+	c.Assert(errors.Is(errs[1], strconv.ErrSyntax), check.Equals, true)
+	c.Assert(strings.Count(errs[1].Error(), "\n"), check.Equals, 1)
+}
+
+func (s *EXMLSuite) Test_AttrsUnmarshalInvalidTarget(c *check.C) {
+	var node OSMNode
+	c.Assert(Attrs{}.Unmarshal(node), check.NotNil)
+	c.Assert(Attrs{}.Unmarshal((*OSMNode)(nil)), check.NotNil)
+	c.Assert(Attrs{}.Unmarshal(&node), check.IsNil)
+}
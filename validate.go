@@ -0,0 +1,209 @@
+package exml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrMissingAttr is reported by an AttrValidator when a required
+	// attribute is absent.
+	ErrMissingAttr = errors.New("missing attribute")
+
+	// ErrInvalidAttr is reported by an AttrValidator when an attribute
+	// value can't be parsed or is not one of the allowed values.
+	ErrInvalidAttr = errors.New("invalid attribute value")
+)
+
+// An AttrError describes a single attribute validation failure. The element
+// name and position are only known when the validator was obtained from
+// Decoder.Require, they are zero values otherwise.
+type AttrError struct {
+	Element xml.Name
+	Line    int
+	Column  int
+	Attr    string
+	Value   string
+	Err     error
+}
+
+func (e *AttrError) Error() string {
+	var b strings.Builder
+	b.WriteString("exml: ")
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "line %d, column %d: ", e.Line, e.Column)
+	}
+	if e.Element.Local != "" {
+		fmt.Fprintf(&b, "<%s> ", e.Element.Local)
+	}
+	fmt.Fprintf(&b, "attribute %q: %v", e.Attr, e.Err)
+	return b.String()
+}
+
+func (e *AttrError) Unwrap() error {
+	return e.Err
+}
+
+// An AttrValidator reads required attribute values and accumulates the
+// errors encountered along the way, which allows to check a whole set of
+// attributes and report all the problems at once:
+//
+//	v := decoder.Require(attrs)
+//	id := v.Int("id", 10, 64)
+//	kind := v.OneOf("kind", "a", "b")
+//	if err := v.Err(); err != nil {
+//	    ...
+//	}
+//
+// Accessors return the zero value of their type when the attribute is
+// missing or invalid.
+type AttrValidator struct {
+	attrs   Attrs
+	element xml.Name
+	line    int
+	column  int
+	errs    []error
+}
+
+// Require returns a validator reading values from the attributes.
+func (a Attrs) Require() *AttrValidator {
+	return &AttrValidator{attrs: a}
+}
+
+// Require returns a validator reading values from the passed attributes
+// whose errors carry the name and position of the current element. It is
+// meant to be called from a tag callback with the attributes it received.
+func (d *Decoder) Require(attrs Attrs) *AttrValidator {
+	return &AttrValidator{
+		attrs:   attrs,
+		element: d.element,
+		line:    d.line,
+		column:  d.column,
+	}
+}
+
+// String returns the value of the requested attribute.
+func (v *AttrValidator) String(name string) string {
+	val, _ := v.get(name)
+	return val
+}
+
+// Bool returns the value of the requested attribute parsed by the
+// strconv.ParseBool() function.
+func (v *AttrValidator) Bool(name string) bool {
+	strVal, ok := v.get(name)
+	if !ok {
+		return false
+	}
+
+	val, err := strconv.ParseBool(strVal)
+	if err != nil {
+		v.fail(name, strVal, err)
+		return false
+	}
+
+	return val
+}
+
+// Float returns the value of the requested attribute parsed by the
+// strconv.ParseFloat() function.
+func (v *AttrValidator) Float(name string, bitsize int) float64 {
+	strVal, ok := v.get(name)
+	if !ok {
+		return 0
+	}
+
+	val, err := strconv.ParseFloat(strVal, bitsize)
+	if err != nil {
+		v.fail(name, strVal, err)
+		return 0
+	}
+
+	return val
+}
+
+// Int returns the value of the requested attribute parsed by the
+// strconv.ParseInt() function.
+func (v *AttrValidator) Int(name string, base int, bitsize int) int64 {
+	strVal, ok := v.get(name)
+	if !ok {
+		return 0
+	}
+
+	val, err := strconv.ParseInt(strVal, base, bitsize)
+	if err != nil {
+		v.fail(name, strVal, err)
+		return 0
+	}
+
+	return val
+}
+
+// UInt returns the value of the requested attribute parsed by the
+// strconv.ParseUint() function.
+func (v *AttrValidator) UInt(name string, base int, bitsize int) uint64 {
+	strVal, ok := v.get(name)
+	if !ok {
+		return 0
+	}
+
+	val, err := strconv.ParseUint(strVal, base, bitsize)
+	if err != nil {
+		v.fail(name, strVal, err)
+		return 0
+	}
+
+	return val
+}
+
+// OneOf returns the value of the requested attribute which must be one of
+// the passed allowed values.
+func (v *AttrValidator) OneOf(name string, allowed ...string) string {
+	val, ok := v.get(name)
+	if !ok {
+		return ""
+	}
+
+	for _, a := range allowed {
+		if val == a {
+			return val
+		}
+	}
+
+	v.fail(name, val, fmt.Errorf("expected one of %s", strings.Join(allowed, ", ")))
+	return ""
+}
+
+// Err returns the accumulated validation errors joined in a single error,
+// or nil when all the requested attributes were present and valid. Each
+// individual error is an *AttrError.
+func (v *AttrValidator) Err() error {
+	return errors.Join(v.errs...)
+}
+
+func (v *AttrValidator) get(name string) (string, bool) {
+	val, ok := v.attrs.Get(name)
+	if !ok {
+		v.errs = append(v.errs, v.error(name, "", ErrMissingAttr))
+	}
+
+	return val, ok
+}
+
+func (v *AttrValidator) fail(name string, value string, err error) {
+	v.errs = append(v.errs, v.error(name, value, fmt.Errorf("%w: %w", ErrInvalidAttr, err)))
+}
+
+func (v *AttrValidator) error(name string, value string, err error) *AttrError {
+	return &AttrError{
+		Element: v.element,
+		Line:    v.line,
+		Column:  v.column,
+		Attr:    name,
+		Value:   value,
+		Err:     err,
+	}
+}
@@ -0,0 +1,81 @@
+package exml
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+const VALIDATE = `<?xml version="1.0"?>
+<root>
+    <node id="42" kind="a" ratio="0.5" enabled="true" count="7" />
+    <node id="foo" kind="c" />
+</root>`
+
+func (s *EXMLSuite) Test_ValidatorSuccess(c *check.C) {
+	v := Attrs{}.Require()
+	c.Assert(v.Err(), check.IsNil)
+
+	decoder := NewDecoder(strings.NewReader(VALIDATE))
+	handlerWasCalled := false
+
+	decoder.On("root/node", func(attrs Attrs) {
+		if handlerWasCalled {
+			return
+		}
+		handlerWasCalled = true
+
+		v := decoder.Require(attrs)
+		c.Assert(v.Int("id", 10, 64), check.Equals, int64(42))
+		c.Assert(v.OneOf("kind", "a", "b"), check.Equals, "a")
+		c.Assert(v.Float("ratio", 64), check.Equals, 0.5)
+		c.Assert(v.Bool("enabled"), check.Equals, true)
+		c.Assert(v.UInt("count", 10, 64), check.Equals, uint64(7))
+		c.Assert(v.String("kind"), check.Equals, "a")
+		c.Assert(v.Err(), check.IsNil)
+	})
+
+	decoder.Run()
+	c.Assert(handlerWasCalled, check.Equals, true)
+}
+
+func (s *EXMLSuite) Test_ValidatorErrors(c *check.C) {
+	decoder := NewDecoder(strings.NewReader(VALIDATE))
+	var err error
+
+	nodeNum := 0
+	decoder.On("root/node", func(attrs Attrs) {
+		nodeNum = nodeNum + 1
+		if nodeNum != 2 {
+			return
+		}
+
+		v := decoder.Require(attrs)
+		c.Assert(v.Int("id", 10, 64), check.Equals, int64(0))
+		c.Assert(v.OneOf("kind", "a", "b"), check.Equals, "")
+		c.Assert(v.String("ratio"), check.Equals, "")
+		err = v.Err()
+	})
+
+	decoder.Run()
+
+	c.Assert(err, check.NotNil)
+	c.Assert(errors.Is(err, ErrInvalidAttr), check.Equals, true)
+	c.Assert(errors.Is(err, ErrMissingAttr), check.Equals, true)
+	c.Assert(errors.Is(err, strconv.ErrSyntax), check.Equals, true)
+
+	var attrErr *AttrError
+	c.Assert(errors.As(err, &attrErr), check.Equals, true)
+	c.Assert(attrErr.Element.Local, check.Equals, "node")
+	c.Assert(attrErr.Attr, check.Equals, "id")
+	c.Assert(attrErr.Value, check.Equals, "foo")
+	c.Assert(attrErr.Line, check.Equals, 4)
+	c.Assert(attrErr.Column, check.Equals, 5)
+
+	lines := strings.Split(err.Error(), "\n")
+	c.Assert(lines, check.HasLen, 3)
+	c.Assert(lines[1], check.Equals, `exml: line 4, column 5: <node> attribute "kind": invalid attribute value: expected one of a, b`)
+	c.Assert(lines[2], check.Equals, `exml: line 4, column 5: <node> attribute "ratio": missing attribute`)
+}